@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// 计算第attempt次(从0开始)重试前的等待时间
+// 按指数增长，最大不超过max,并在[0, d]范围内加入随机抖动
+func retryBackoff(attempt int, min, max time.Duration) time.Duration {
+	return jitterBackoff(attempt, min, max, 1)
+}
+
+// 与retryBackoff相同，但只对等待时间中jitter比例的部分加入随机抖动
+// jitter为0时不抖动，为1时在[0, d]范围内抖动
+func jitterBackoff(attempt int, min, max time.Duration, jitter float64) time.Duration {
+	if min <= 0 {
+		return 0
+	}
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	if jitter <= 0 {
+		return d
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	random := int64(float64(d) * jitter)
+	return d - time.Duration(random) + time.Duration(rand.Int63n(random+1))
+}
+
+// 等待d,context被取消时提前返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
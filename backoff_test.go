@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterBackoff(t *testing.T) {
+	min, max := 10*time.Millisecond, 500*time.Millisecond
+	tests := []struct {
+		name     string
+		attempt  int
+		min, max time.Duration
+		jitter   float64
+		wantMin  time.Duration
+		wantMax  time.Duration
+	}{
+		{"first attempt", 0, min, max, 0, min, min},
+		{"doubling", 3, min, max, 0, 80 * time.Millisecond, 80 * time.Millisecond},
+		{"capped", 10, min, max, 0, max, max},
+		{"many attempts", 1000, min, max, 0, max, max},
+		{"zero min", 5, 0, max, 1, 0, 0},
+		{"half jitter", 2, min, max, 0.5, 20 * time.Millisecond, 40 * time.Millisecond},
+		{"full jitter", 10, min, max, 1, 0, max},
+		{"jitter above one", 10, min, max, 3, 0, max},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got := jitterBackoff(tt.attempt, tt.min, tt.max, tt.jitter)
+				if got < tt.wantMin || got > tt.wantMax {
+					t.Fatalf("jitterBackoff() = %v, want in [%v, %v]", got, tt.wantMin, tt.wantMax)
+				}
+			}
+		})
+	}
+}
@@ -11,7 +11,7 @@ import (
 type Heartbeat struct {
 	stop chan chan struct{}
 
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 	options     *Options
 }
 
@@ -23,9 +23,11 @@ type HeartbeatError struct {
 type Options struct {
 	Interval     time.Duration
 	HeartbeatKey string
+	//心跳key的有效期,为0时与Interval相同
+	Expiration time.Duration
 }
 
-func NewHeartbeat(redisClient *redis.Client, opts ...Options) *Heartbeat {
+func NewHeartbeat(redisClient redis.UniversalClient, opts ...Options) *Heartbeat {
 	options := &Options{
 		Interval:     time.Second,
 		HeartbeatKey: "mq::connection::heartbeat",
@@ -100,5 +102,9 @@ func (b *Heartbeat) Stop() error {
 
 func (b *Heartbeat) hitHeartbeart() error {
 	context := context.TODO()
-	return b.redisClient.Set(context, b.options.HeartbeatKey, "ok", b.options.Interval).Err()
+	expiration := b.options.Expiration
+	if expiration <= 0 {
+		expiration = b.options.Interval
+	}
+	return b.redisClient.Set(context, b.options.HeartbeatKey, "ok", expiration).Err()
 }
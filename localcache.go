@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"container/list"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// 本地缓存中的一项
+type localCacheEntry struct {
+	key       string
+	value     IRedisValue
+	size      int64
+	expiredAt time.Time
+}
+
+// generation计数器的分段数，key按hash分到各段，不同key落在同一段时只会导致少缓存一次
+const localCacheGenerationStripes = 1024
+
+// 有容量限制的进程内LRU缓存，每一项都带有有效期
+type localCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+
+	ll      *list.List
+	items   map[string]*list.Element
+	bytes   int64
+	evicted uint64
+
+	//每次删除key时递增对应分段的计数，清空时递增全局计数
+	//从redis读取前记录generation,写入本地缓存时generation已经变化说明读取期间收到了失效消息，不再写入
+	generations [localCacheGenerationStripes]uint64
+	generation  uint64
+}
+
+func newLocalCache(maxEntries int, maxBytes int64, ttl time.Duration) *localCache {
+	return &localCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *localCache) get(key string) (IRedisValue, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*localCacheEntry)
+	if !entry.expiredAt.IsZero() && time.Now().After(entry.expiredAt) {
+		c.removeElement(e)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+// 返回key当前的generation
+func (c *localCache) keyGeneration(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.keyGenerationLocked(key)
+}
+
+// 写入一项，有效期为ttl与缓存默认有效期中较短的一个，ttl<=0表示不限制
+// key的generation与gen不一致时说明读取之后key已经失效，不写入
+func (c *localCache) set(key string, value IRedisValue, ttl time.Duration, gen uint64) {
+	size := int64(len(key) + len(value.Bytes()))
+	if c.maxBytes > 0 && size > c.maxBytes {
+		//单项超过了容量限制，不缓存
+		return
+	}
+	if c.ttl > 0 && (ttl <= 0 || c.ttl < ttl) {
+		ttl = c.ttl
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.keyGenerationLocked(key) != gen {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	entry := &localCacheEntry{
+		key:   key,
+		value: value,
+		size:  size,
+	}
+	if ttl > 0 {
+		entry.expiredAt = time.Now().Add(ttl)
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	c.bytes += size
+	for c.overflow() {
+		c.removeElement(c.ll.Back())
+		c.evicted++
+	}
+}
+
+func (c *localCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[generationStripe(key)]++
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *localCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// 返回当前的项数，占用字节数及淘汰的项数
+func (c *localCache) stats() (int, int64, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len(), c.bytes, c.evicted
+}
+
+func (c *localCache) overflow() bool {
+	if c.ll.Len() <= 0 {
+		return false
+	}
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+func (c *localCache) keyGenerationLocked(key string) uint64 {
+	return c.generation + c.generations[generationStripe(key)]
+}
+
+func generationStripe(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32() % localCacheGenerationStripes
+}
+
+func (c *localCache) removeElement(e *list.Element) {
+	entry := e.Value.(*localCacheEntry)
+	c.ll.Remove(e)
+	delete(c.items, entry.key)
+	c.bytes -= entry.size
+}
@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheTTL  time.Duration
+		entryTTL  time.Duration
+		wait      time.Duration
+		wantFound bool
+	}{
+		{"redis ttl shorter than cache ttl", time.Minute, 20 * time.Millisecond, 40 * time.Millisecond, false},
+		{"redis ttl longer than cache ttl", 20 * time.Millisecond, time.Minute, 40 * time.Millisecond, false},
+		{"within both ttls", time.Minute, time.Minute, 0, true},
+		{"no redis ttl uses cache ttl", 20 * time.Millisecond, 0, 40 * time.Millisecond, false},
+		{"no ttl at all", 0, 0, 20 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLocalCache(0, 0, tt.cacheTTL)
+			c.set("k", newRedisValue([]byte("v"), DefaultUnmarshal), tt.entryTTL, c.keyGeneration("k"))
+			time.Sleep(tt.wait)
+			if _, ok := c.get("k"); ok != tt.wantFound {
+				t.Fatalf("get found=%v, want %v", ok, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestLocalCacheGeneration(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *localCache)
+		wantFound  bool
+	}{
+		{"no invalidation", func(c *localCache) {}, true},
+		{"key removed while loading", func(c *localCache) { c.remove("k") }, false},
+		{"cache cleared while loading", func(c *localCache) { c.clear() }, false},
+		{"other key removed while loading", func(c *localCache) { c.remove("other") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLocalCache(0, 0, time.Minute)
+			gen := c.keyGeneration("k")
+			tt.invalidate(c)
+			c.set("k", newRedisValue([]byte("v"), DefaultUnmarshal), 0, gen)
+			if _, ok := c.get("k"); ok != tt.wantFound {
+				t.Fatalf("get found=%v, want %v", ok, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestLocalCacheEviction(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		keys       []string
+		wantKeys   []string
+		wantGone   []string
+	}{
+		{"max entries evicts least recently used", 2, 0, []string{"a", "b", "c"}, []string{"b", "c"}, []string{"a"}},
+		{"max bytes evicts least recently used", 0, 4, []string{"a", "b", "c"}, []string{"b", "c"}, []string{"a"}},
+		{"within limits keeps all", 3, 0, []string{"a", "b", "c"}, []string{"a", "b", "c"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLocalCache(tt.maxEntries, tt.maxBytes, time.Minute)
+			for _, eachKey := range tt.keys {
+				c.set(eachKey, newRedisValue([]byte("v"), DefaultUnmarshal), 0, c.keyGeneration(eachKey))
+			}
+			for _, eachKey := range tt.wantKeys {
+				if _, ok := c.get(eachKey); !ok {
+					t.Errorf("key %s evicted", eachKey)
+				}
+			}
+			for _, eachKey := range tt.wantGone {
+				if _, ok := c.get(eachKey); ok {
+					t.Errorf("key %s not evicted", eachKey)
+				}
+			}
+		})
+	}
+}
@@ -1,10 +1,30 @@
 package redis
 
 import (
+	"bytes"
 	"encoding/json"
 	"strconv"
 )
 
+// 负缓存的墓碑值,表示该key已经确认不存在
+// 以\x00\xfe\xff开头，不是合法的UTF-8,也不会由_marshal对json、数值、bool等类型编码产生
+var tombstone = []byte("\x00\xfe\xffredisx:absent\x00")
+
+// 判断数据是否为墓碑值
+func isTombstone(b []byte) bool {
+	return bytes.Equal(b, tombstone)
+}
+
+// 默认的反序列化实现，供其它包使用
+func DefaultUnmarshal(b []byte, value interface{}) error {
+	return _unmarshal(b, value)
+}
+
+// 默认的序列化实现，供其它包使用
+func DefaultMarshal(value interface{}) ([]byte, error) {
+	return _marshal(value)
+}
+
 // json反序列化实现
 func _unmarshal(b []byte, value interface{}) error {
 	if len(b) == 0 {
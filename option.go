@@ -25,23 +25,28 @@ type (
 
 // 模块参数配置
 type RedisOptions struct {
-	client    *redis.Client
+	client    redis.UniversalClient
 	KeyPrefix string
 	//默认的有效期时间,如果不设，则表示没有有效期
 	DefaultTTL *time.Duration
 
 	Unmarshal UnmarshalFunc
 	Marshal   MarshalFunc
+
+	//合并同一进程内对同一key的并发加载
+	loadGroup *flightGroup
 }
 
 // 创建默认的配置项
-func NewRedisOptions(client *redis.Client) *RedisOptions {
+// client可以是*redis.Client、*redis.ClusterClient、*redis.Ring或redis.NewUniversalClient创建的任意实现
+func NewRedisOptions(client redis.UniversalClient) *RedisOptions {
 	noTTL := Redis_NoExpiration_TTL
 	return &RedisOptions{
 		client:     client,
 		DefaultTTL: &noTTL,
 		Unmarshal:  _unmarshal,
 		Marshal:    _marshal,
+		loadGroup:  newFlightGroup(),
 	}
 }
 
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// 消息的存储方式
+// 默认使用list,通过WithStreamBackend可以切换为Redis Streams
+type backend interface {
+	//初始化
+	setup(ctx context.Context) error
+	//将已编码的消息放入对应优先级的待处理队列
+	push(ctx context.Context, m *Message) error
+	//取出一条消息并标记为当前消费者正在处理
+	dequeue(ctx context.Context, timeout time.Duration) (*Message, error)
+	//确认消息
+	ack(ctx context.Context, m *Message) error
+	//将消息立即放回待处理队列
+	nack(ctx context.Context, m *Message) error
+	//将消息以新的编码raw移入对应优先级的delayed有序集合，在dueAt之后重试
+	retry(ctx context.Context, m *Message, raw string, dueAt time.Time) error
+	//将消息以新的编码raw移入死信队列
+	bury(ctx context.Context, m *Message, raw string) error
+	//将指定优先级最多limit条到期的延迟消息移入待处理队列
+	promote(ctx context.Context, priority int, now time.Time, limit int) (int, error)
+	//将死信oldRaw以m的新编码放回对应优先级的待处理队列
+	requeueDead(ctx context.Context, oldRaw string, m *Message) (bool, error)
+	//回收失效消费者正在处理的消息
+	reap(ctx context.Context) (int, error)
+	//列出正在处理中的消息
+	pending(ctx context.Context, count int64) ([]PendingMessage, error)
+	//统计待处理、处理中的消息数以及最早消息的等待时间
+	counts(ctx context.Context, stats *QueueStats) error
+	//删除所有待处理、处理中的消息
+	purge(ctx context.Context) error
+}
+
+// 正在处理中(已取出但未确认)的消息
+type PendingMessage struct {
+	//消息id,list模式下为Message.ID,stream模式下为stream的entry id
+	ID string
+	//正在处理该消息的消费者
+	Consumer string
+	//消息被取出后经过的时间,list模式下为0
+	Idle time.Duration
+	//消息被投递的次数,list模式下为0
+	DeliveryCount int64
+}
+
+// 列出正在处理中的消息，最多返回count条
+func (q *Queue) Pending(ctx context.Context, count int64) ([]PendingMessage, error) {
+	return q.backend.pending(ctx, count)
+}
@@ -0,0 +1,322 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	//将消息从processing list移回ready list
+	nackCommand = `local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+if removed == 0 then
+	return 0
+end
+redis.call("RPUSH", KEYS[2], ARGV[1])
+return 1`
+
+	//消费者心跳已经失效时，将其processing list中的消息全部移回对应优先级的ready list
+	//KEYS[4]及之后依次为优先级0,1,2...的ready list
+	reapCommand = `if redis.call("EXISTS", KEYS[1]) == 1 then
+	return -1
+end
+local count = 0
+while true do
+	local msg = redis.call("LPOP", KEYS[2])
+	if not msg then
+		break
+	end
+	local priority = 0
+	local ok, decoded = pcall(cjson.decode, msg)
+	if ok and type(decoded) == "table" and type(decoded["priority"]) == "number" then
+		priority = decoded["priority"]
+	end
+	redis.call("RPUSH", KEYS[4 + priority] or KEYS[4], msg)
+	count = count + 1
+end
+redis.call("SREM", KEYS[3], ARGV[1])
+return count`
+
+	//按顺序尝试从多个ready list中取出一条消息移入processing list
+	//KEYS[1]为processing list,KEYS[2]及之后为按尝试顺序排列的ready list
+	popCommand = `for i = 2, #KEYS do
+	local msg = redis.call("LMOVE", KEYS[i], KEYS[1], "RIGHT", "LEFT")
+	if msg then
+		return msg
+	end
+end
+return false`
+
+	//将到期的消息从delayed有序集合移入ready list
+	//ZREM与LPUSH在同一个脚本中执行，多个实例同时执行时每条消息只会被移动一次
+	promoteCommand = `local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, msg in ipairs(due) do
+	redis.call("ZREM", KEYS[1], msg)
+	redis.call("LPUSH", KEYS[2], msg)
+end
+return #due`
+
+	//将失败的消息从processing list移入delayed有序集合等待重试
+	retryCommand = `local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+if removed == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[3], ARGV[2])
+return 1`
+
+	//将消息从源list中删除，并以新的编码放入目标list
+	//用于将最终失败的消息移入死信list,以及将死信放回ready list
+	moveCommand = `local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+if removed == 0 then
+	return 0
+end
+redis.call("LPUSH", KEYS[2], ARGV[2])
+return 1`
+)
+
+// 所有ready list都为空后一次阻塞等待的最长时长，需小于连接的读超时
+const priorityBlockInterval = time.Second
+
+// 基于list的存储方式
+// 消息通过BLMOVE原子地移入每个消费者的processing list,确认后删除
+// 每个优先级使用单独的ready list
+type listBackend struct {
+	q *Queue
+}
+
+func newListBackend(q *Queue) *listBackend {
+	return &listBackend{q: q}
+}
+
+func (b *listBackend) setup(ctx context.Context) error {
+	return nil
+}
+
+func (b *listBackend) push(ctx context.Context, m *Message) error {
+	return b.q.options.client.LPush(ctx, b.q.readyKey(m.Priority), m.raw).Err()
+}
+
+// 只有一个优先级时直接使用BLMOVE阻塞等待
+// 多个优先级时先按顺序非阻塞地尝试所有ready list,都为空时阻塞等待最高优先级的list,
+// 此时其它优先级新到达的消息最多延迟priorityBlockInterval被取出
+// 每次阻塞不超过priorityBlockInterval以及剩余的等待时间
+func (b *listBackend) dequeue(ctx context.Context, timeout time.Duration) (*Message, error) {
+	q := b.q
+	processingKey := q.processingKey(q.consumerID)
+	order := q.priorityOrder()
+	keys := make([]string, 0, len(order)+1)
+	keys = append(keys, processingKey)
+	for _, eachPriority := range order {
+		keys = append(keys, q.readyKey(eachPriority))
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		if len(order) > 1 {
+			raw, err := q.options.client.Eval(ctx, popCommand, keys).Text()
+			if err == nil {
+				return b.decodeProcessing(ctx, raw, processingKey)
+			}
+			if err != redis.Nil {
+				return nil, err
+			}
+		}
+		if timeout > 0 && time.Until(deadline) <= 0 {
+			return nil, ErrNoMessage
+		}
+		msg, err := b.blockingMove(ctx, q.readyKey(q.options.priorities-1), processingKey, priorityBlock(timeout, deadline))
+		if err != ErrNoMessage {
+			return msg, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// go-redis的BLMove会将timeout截断为整秒，这里直接发送BLMOVE,timeout按小数秒传递
+// Do不会为阻塞命令延长读超时，调用方需保证timeout小于连接的读超时
+func (b *listBackend) blockingMove(ctx context.Context, readyKey string, processingKey string, timeout time.Duration) (*Message, error) {
+	raw, err := b.q.options.client.Do(ctx, "BLMOVE", readyKey, processingKey, "RIGHT", "LEFT",
+		strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)).Text()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNoMessage
+		}
+		return nil, err
+	}
+	return b.decodeProcessing(ctx, raw, processingKey)
+}
+
+func (b *listBackend) decodeProcessing(ctx context.Context, raw string, processingKey string) (*Message, error) {
+	q := b.q
+	msg, err := decodeMessage(q, raw)
+	if err != nil {
+		//无法解析的消息直接丢弃，避免阻塞队列
+		q.options.client.LRem(ctx, processingKey, 1, raw)
+		return nil, err
+	}
+	msg.processingKey = processingKey
+	return msg, nil
+}
+
+func (b *listBackend) ack(ctx context.Context, m *Message) error {
+	removed, err := b.q.options.client.LRem(ctx, m.processingKey, 1, m.raw).Result()
+	return checkMoved(removed, err)
+}
+
+func (b *listBackend) nack(ctx context.Context, m *Message) error {
+	keys := []string{m.processingKey, b.q.readyKey(m.Priority)}
+	return checkMoved(b.q.options.client.Eval(ctx, nackCommand, keys, m.raw).Int64())
+}
+
+func (b *listBackend) retry(ctx context.Context, m *Message, raw string, dueAt time.Time) error {
+	keys := []string{m.processingKey, b.q.delayedKey(m.Priority)}
+	score := strconv.FormatInt(dueAt.UnixMilli(), 10)
+	return checkMoved(b.q.options.client.Eval(ctx, retryCommand, keys, m.raw, raw, score).Int64())
+}
+
+func (b *listBackend) bury(ctx context.Context, m *Message, raw string) error {
+	keys := []string{m.processingKey, b.q.deadKey()}
+	return checkMoved(b.q.options.client.Eval(ctx, moveCommand, keys, m.raw, raw).Int64())
+}
+
+func (b *listBackend) promote(ctx context.Context, priority int, now time.Time, limit int) (int, error) {
+	keys := []string{b.q.delayedKey(priority), b.q.readyKey(priority)}
+	return b.q.options.client.Eval(ctx, promoteCommand, keys, now.UnixMilli(), limit).Int()
+}
+
+func (b *listBackend) requeueDead(ctx context.Context, oldRaw string, m *Message) (bool, error) {
+	keys := []string{b.q.deadKey(), b.q.readyKey(m.Priority)}
+	moved, err := b.q.options.client.Eval(ctx, moveCommand, keys, oldRaw, m.raw).Int64()
+	if err != nil {
+		return false, err
+	}
+	return moved > 0, nil
+}
+
+// 将心跳已经失效的消费者processing list中的消息移回ready list
+func (b *listBackend) reap(ctx context.Context) (int, error) {
+	q := b.q
+	consumers, err := q.options.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, eachConsumer := range consumers {
+		if eachConsumer == q.consumerID && q.heartbeat != nil {
+			continue
+		}
+		keys := []string{
+			q.heartbeatKey(eachConsumer),
+			q.processingKey(eachConsumer),
+			q.consumersKey(),
+		}
+		for priority := 0; priority < q.options.priorities; priority++ {
+			keys = append(keys, q.readyKey(priority))
+		}
+		count, err := q.options.client.Eval(ctx, reapCommand, keys, eachConsumer).Int()
+		if err != nil {
+			return total, err
+		}
+		if count > 0 {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+func (b *listBackend) pending(ctx context.Context, count int64) ([]PendingMessage, error) {
+	q := b.q
+	consumers, err := q.options.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]PendingMessage, 0)
+	for _, eachConsumer := range consumers {
+		remaining := count - int64(len(result))
+		if remaining <= 0 {
+			break
+		}
+		raws, err := q.options.client.LRange(ctx, q.processingKey(eachConsumer), 0, remaining-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, eachRaw := range raws {
+			msg, err := decodeMessage(q, eachRaw)
+			if err != nil {
+				continue
+			}
+			result = append(result, PendingMessage{
+				ID:       msg.ID,
+				Consumer: eachConsumer,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (b *listBackend) counts(ctx context.Context, stats *QueueStats) error {
+	q := b.q
+	consumers, err := q.options.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return err
+	}
+	var readyCmds, processingCmds []*redis.IntCmd
+	var oldestCmds []*redis.StringCmd
+	_, err = q.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for priority := 0; priority < q.options.priorities; priority++ {
+			readyCmds = append(readyCmds, pipe.LLen(ctx, q.readyKey(priority)))
+			//LPUSH入队,最早的消息在列表尾部
+			oldestCmds = append(oldestCmds, pipe.LIndex(ctx, q.readyKey(priority), -1))
+		}
+		for _, eachConsumer := range consumers {
+			processingCmds = append(processingCmds, pipe.LLen(ctx, q.processingKey(eachConsumer)))
+			oldestCmds = append(oldestCmds, pipe.LIndex(ctx, q.processingKey(eachConsumer), -1))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	for _, eachCmd := range readyCmds {
+		stats.Ready += eachCmd.Val()
+	}
+	for _, eachCmd := range processingCmds {
+		stats.Processing += eachCmd.Val()
+	}
+	for _, eachCmd := range oldestCmds {
+		if eachCmd.Err() == nil {
+			stats.observeOldest(q, eachCmd.Val())
+		}
+	}
+	return nil
+}
+
+func (b *listBackend) purge(ctx context.Context) error {
+	q := b.q
+	consumers, err := q.options.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, q.options.priorities+len(consumers))
+	for priority := 0; priority < q.options.priorities; priority++ {
+		keys = append(keys, q.readyKey(priority))
+	}
+	for _, eachConsumer := range consumers {
+		keys = append(keys, q.processingKey(eachConsumer))
+	}
+	return q.options.client.Del(ctx, keys...).Err()
+}
+
+// 将脚本或者LREM的返回值转换为错误，返回0表示消息已经不在原来的位置
+func checkMoved(moved int64, err error) error {
+	if err != nil {
+		return err
+	}
+	if moved == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,508 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	//消息在stream entry中的字段名
+	streamMessageField = "msg"
+
+	//确认消息并从stream中删除
+	streamAckCommand = `local acked = redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+if acked == 0 then
+	return 0
+end
+redis.call("XDEL", KEYS[1], ARGV[2])
+return 1`
+
+	//确认消息并重新添加到stream的末尾
+	//ARGV[4]及之后为XADD的trim参数
+	streamNackCommand = `local acked = redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+if acked == 0 then
+	return 0
+end
+redis.call("XDEL", KEYS[1], ARGV[2])
+local args = {KEYS[1]}
+for i = 4, #ARGV do
+	table.insert(args, ARGV[i])
+end
+table.insert(args, "*")
+table.insert(args, "` + streamMessageField + `")
+table.insert(args, ARGV[3])
+redis.call("XADD", unpack(args))
+return 1`
+
+	//确认消息并以新的编码移入delayed有序集合
+	streamRetryCommand = `local acked = redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+if acked == 0 then
+	return 0
+end
+redis.call("XDEL", KEYS[1], ARGV[2])
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[3])
+return 1`
+
+	//确认消息并以新的编码移入死信list
+	streamBuryCommand = `local acked = redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+if acked == 0 then
+	return 0
+end
+redis.call("XDEL", KEYS[1], ARGV[2])
+redis.call("LPUSH", KEYS[2], ARGV[3])
+return 1`
+
+	//将到期的消息从delayed有序集合移入stream
+	//ARGV[3]及之后为XADD的trim参数
+	streamPromoteCommand = `local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, msg in ipairs(due) do
+	redis.call("ZREM", KEYS[1], msg)
+	local args = {KEYS[2]}
+	for i = 3, #ARGV do
+		table.insert(args, ARGV[i])
+	end
+	table.insert(args, "*")
+	table.insert(args, "` + streamMessageField + `")
+	table.insert(args, msg)
+	redis.call("XADD", unpack(args))
+end
+return #due`
+
+	//将死信移回stream
+	//ARGV[3]及之后为XADD的trim参数
+	streamRequeueDeadCommand = `local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+if removed == 0 then
+	return 0
+end
+local args = {KEYS[2]}
+for i = 3, #ARGV do
+	table.insert(args, ARGV[i])
+end
+table.insert(args, "*")
+table.insert(args, "` + streamMessageField + `")
+table.insert(args, ARGV[2])
+redis.call("XADD", unpack(args))
+return 1`
+)
+
+// Redis Streams存储方式的配置
+type StreamOptions struct {
+	//消费者组名称，默认为"default"
+	Group string
+	//按长度裁剪stream,为0表示不按长度裁剪
+	MaxLen int64
+	//裁剪掉早于MinIDAge的entry,为0表示不按时间裁剪，需要redis 6.2及以上版本
+	MinIDAge time.Duration
+	//裁剪时是否精确裁剪，默认使用性能更好的近似裁剪(~)
+	Exact bool
+	//其它消费者的消息空闲超过ClaimIdle后会被当前消费者认领，默认为1分钟，小于0表示不认领
+	ClaimIdle time.Duration
+}
+
+// 使用Redis Streams消费者组作为存储方式，opts中为零值的字段使用默认值
+// 消息通过XADD写入，XREADGROUP读取，XACK确认，崩溃的消费者未确认的消息由其它消费者通过XAUTOCLAIM认领
+// 注意裁剪会删除尚未被消费的entry,MaxLen、MinIDAge需要大于队列可能积压的消息数、时间
+func WithStreamBackend(opts ...StreamOptions) QueueOption {
+	return func(q *Queue) {
+		streamOptions := &StreamOptions{
+			Group:     "default",
+			ClaimIdle: time.Minute,
+		}
+		if len(opts) > 0 {
+			streamOptions.overlay(opts[0])
+		}
+		q.options.stream = streamOptions
+	}
+}
+
+// 用o中不为零值的字段覆盖当前配置
+func (so *StreamOptions) overlay(o StreamOptions) {
+	if len(o.Group) > 0 {
+		so.Group = o.Group
+	}
+	if o.MaxLen > 0 {
+		so.MaxLen = o.MaxLen
+	}
+	if o.MinIDAge > 0 {
+		so.MinIDAge = o.MinIDAge
+	}
+	if o.Exact {
+		so.Exact = true
+	}
+	if o.ClaimIdle != 0 {
+		so.ClaimIdle = o.ClaimIdle
+	}
+}
+
+type streamBackend struct {
+	q       *Queue
+	options *StreamOptions
+}
+
+func newStreamBackend(q *Queue, options *StreamOptions) *streamBackend {
+	return &streamBackend{
+		q:       q,
+		options: options,
+	}
+}
+
+// 为每个优先级的stream创建消费者组，已经存在时忽略
+func (b *streamBackend) setup(ctx context.Context) error {
+	for priority := 0; priority < b.q.options.priorities; priority++ {
+		err := b.q.options.client.XGroupCreateMkStream(ctx, b.q.streamKey(priority), b.options.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *streamBackend) push(ctx context.Context, m *Message) error {
+	args := []interface{}{"XADD", b.q.streamKey(m.Priority)}
+	args = append(args, b.trimArgs()...)
+	args = append(args, "*", streamMessageField, m.raw)
+	return b.q.options.client.Do(ctx, args...).Err()
+}
+
+// 优先认领其它消费者空闲的消息，没有时再读取新消息
+// 多个优先级时先按顺序非阻塞地读取所有stream,都没有新消息时阻塞等待最高优先级的stream,
+// 此时其它优先级新到达的消息最多延迟priorityBlockInterval被读取
+func (b *streamBackend) dequeue(ctx context.Context, timeout time.Duration) (*Message, error) {
+	order := b.q.priorityOrder()
+	if b.options.ClaimIdle > 0 {
+		for _, eachPriority := range order {
+			msg, err := b.claim(ctx, b.q.streamKey(eachPriority))
+			if err != nil || msg != nil {
+				return msg, err
+			}
+		}
+	}
+	if len(order) == 1 {
+		return b.readGroup(ctx, b.q.streamKey(order[0]), timeout)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, eachPriority := range order {
+			//Block小于0时不阻塞
+			msg, err := b.readGroup(ctx, b.q.streamKey(eachPriority), -1)
+			if err != ErrNoMessage {
+				return msg, err
+			}
+		}
+		if timeout > 0 && time.Until(deadline) <= 0 {
+			return nil, ErrNoMessage
+		}
+		msg, err := b.readGroup(ctx, b.q.streamKey(b.q.options.priorities-1), priorityBlock(timeout, deadline))
+		if err != ErrNoMessage {
+			return msg, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 从stream中读取一条新消息，block小于0时不阻塞，等于0时一直阻塞
+func (b *streamBackend) readGroup(ctx context.Context, streamKey string, block time.Duration) (*Message, error) {
+	streams, err := b.q.options.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    b.options.Group,
+		Consumer: b.q.consumerID,
+		Streams:  []string{streamKey, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrNoMessage
+		}
+		return nil, err
+	}
+	for _, eachStream := range streams {
+		for _, eachEntry := range eachStream.Messages {
+			return b.decodeEntry(ctx, streamKey, eachEntry.ID, eachEntry.Values)
+		}
+	}
+	return nil, ErrNoMessage
+}
+
+// 通过XAUTOCLAIM认领一条空闲超过ClaimIdle的消息
+// go-redis v8的XAutoClaim无法解析redis 7返回的3个元素，这里直接解析原始返回值
+func (b *streamBackend) claim(ctx context.Context, streamKey string) (*Message, error) {
+	reply, err := b.q.options.client.Do(ctx, "XAUTOCLAIM", streamKey, b.options.Group, b.q.consumerID,
+		b.options.ClaimIdle.Milliseconds(), "0-0", "COUNT", 1).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 2 {
+		return nil, nil
+	}
+	entries, _ := reply[1].([]interface{})
+	for _, eachEntry := range entries {
+		entry, ok := eachEntry.([]interface{})
+		if !ok || len(entry) < 2 {
+			continue
+		}
+		id, _ := entry[0].(string)
+		fields, ok := entry[1].([]interface{})
+		if !ok {
+			//entry已经被删除
+			b.q.options.client.XAck(ctx, streamKey, b.options.Group, id)
+			continue
+		}
+		values := make(map[string]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			values[fmt.Sprint(fields[i])] = fields[i+1]
+		}
+		msg, err := b.decodeEntry(ctx, streamKey, id, values)
+		if err != nil {
+			return nil, err
+		}
+		exhausted, err := b.buryExhausted(ctx, msg)
+		if err != nil || exhausted {
+			return nil, err
+		}
+		return msg, nil
+	}
+	return nil, nil
+}
+
+// 认领的消息已经被投递过RetryPolicy.MaxAttempts次仍未确认时直接移入死信队列，
+// 避免导致消费者崩溃的消息被无限次认领
+func (b *streamBackend) buryExhausted(ctx context.Context, msg *Message) (bool, error) {
+	entries, err := b.q.options.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: msg.streamKey,
+		Group:  b.options.Group,
+		Start:  msg.streamID,
+		End:    msg.streamID,
+		Count:  1,
+	}).Result()
+	if err != nil || len(entries) <= 0 {
+		return false, err
+	}
+	maxAttempts := b.q.options.retryPolicy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	//XAUTOCLAIM已经将投递次数加1,不包括本次认领
+	delivered := int(entries[0].RetryCount) - 1
+	if delivered < maxAttempts {
+		return false, nil
+	}
+	dead := *msg
+	dead.Attempts += delivered
+	dead.LastError = fmt.Sprintf("queue: message delivered %d times without ack", delivered)
+	raw, err := dead.encode()
+	if err != nil {
+		return false, err
+	}
+	if err := msg.bury(ctx, raw); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *streamBackend) decodeEntry(ctx context.Context, streamKey string, id string, values map[string]interface{}) (*Message, error) {
+	raw, _ := values[streamMessageField].(string)
+	msg, err := decodeMessage(b.q, raw)
+	if err != nil {
+		//无法解析的消息直接确认并删除，避免反复投递
+		b.q.options.client.Eval(ctx, streamAckCommand, []string{streamKey}, b.options.Group, id)
+		return nil, err
+	}
+	msg.streamID = id
+	msg.streamKey = streamKey
+	return msg, nil
+}
+
+func (b *streamBackend) ack(ctx context.Context, m *Message) error {
+	keys := []string{m.streamKey}
+	return checkMoved(b.q.options.client.Eval(ctx, streamAckCommand, keys, b.options.Group, m.streamID).Int64())
+}
+
+func (b *streamBackend) nack(ctx context.Context, m *Message) error {
+	keys := []string{m.streamKey}
+	args := append([]interface{}{b.options.Group, m.streamID, m.raw}, b.trimArgs()...)
+	return checkMoved(b.q.options.client.Eval(ctx, streamNackCommand, keys, args...).Int64())
+}
+
+func (b *streamBackend) retry(ctx context.Context, m *Message, raw string, dueAt time.Time) error {
+	keys := []string{m.streamKey, b.q.delayedKey(m.Priority)}
+	score := strconv.FormatInt(dueAt.UnixMilli(), 10)
+	return checkMoved(b.q.options.client.Eval(ctx, streamRetryCommand, keys, b.options.Group, m.streamID, raw, score).Int64())
+}
+
+func (b *streamBackend) bury(ctx context.Context, m *Message, raw string) error {
+	keys := []string{m.streamKey, b.q.deadKey()}
+	return checkMoved(b.q.options.client.Eval(ctx, streamBuryCommand, keys, b.options.Group, m.streamID, raw).Int64())
+}
+
+func (b *streamBackend) promote(ctx context.Context, priority int, now time.Time, limit int) (int, error) {
+	keys := []string{b.q.delayedKey(priority), b.q.streamKey(priority)}
+	args := append([]interface{}{now.UnixMilli(), limit}, b.trimArgs()...)
+	return b.q.options.client.Eval(ctx, streamPromoteCommand, keys, args...).Int()
+}
+
+func (b *streamBackend) requeueDead(ctx context.Context, oldRaw string, m *Message) (bool, error) {
+	keys := []string{b.q.deadKey(), b.q.streamKey(m.Priority)}
+	args := append([]interface{}{oldRaw, m.raw}, b.trimArgs()...)
+	moved, err := b.q.options.client.Eval(ctx, streamRequeueDeadCommand, keys, args...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return moved > 0, nil
+}
+
+// 空闲的消息由dequeue认领，这里只删除心跳已经失效并且没有未确认消息的组内消费者，
+// 避免每次启动使用新的消费者id时组内的消费者无限增长，返回删除的消费者数
+func (b *streamBackend) reap(ctx context.Context) (int, error) {
+	q := b.q
+	consumers, err := q.options.client.SMembers(ctx, q.consumersKey()).Result()
+	if err != nil {
+		return 0, err
+	}
+	alive := make(map[string]bool, len(consumers))
+	for _, eachConsumer := range consumers {
+		exists, err := q.options.client.Exists(ctx, q.heartbeatKey(eachConsumer)).Result()
+		if err != nil {
+			return 0, err
+		}
+		alive[eachConsumer] = exists > 0
+	}
+	alive[q.consumerID] = true
+
+	total := 0
+	//仍有未确认消息的消费者在消息被认领之后再删除
+	busy := make(map[string]bool)
+	for priority := 0; priority < q.options.priorities; priority++ {
+		streamKey := q.streamKey(priority)
+		groupConsumers, err := q.options.client.XInfoConsumers(ctx, streamKey, b.options.Group).Result()
+		if err != nil {
+			return total, err
+		}
+		for _, eachConsumer := range groupConsumers {
+			if alive[eachConsumer.Name] {
+				continue
+			}
+			if eachConsumer.Pending > 0 {
+				busy[eachConsumer.Name] = true
+				continue
+			}
+			//组内存在但没有注册或者心跳已经失效的消费者
+			if err := q.options.client.XGroupDelConsumer(ctx, streamKey, b.options.Group, eachConsumer.Name).Err(); err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+	for _, eachConsumer := range consumers {
+		if alive[eachConsumer] || busy[eachConsumer] {
+			continue
+		}
+		if err := q.options.client.SRem(ctx, q.consumersKey(), eachConsumer).Err(); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (b *streamBackend) pending(ctx context.Context, count int64) ([]PendingMessage, error) {
+	result := make([]PendingMessage, 0)
+	for priority := b.q.options.priorities - 1; priority >= 0; priority-- {
+		remaining := count - int64(len(result))
+		if remaining <= 0 {
+			break
+		}
+		entries, err := b.q.options.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: b.q.streamKey(priority),
+			Group:  b.options.Group,
+			Start:  "-",
+			End:    "+",
+			Count:  remaining,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, eachEntry := range entries {
+			result = append(result, PendingMessage{
+				ID:            eachEntry.ID,
+				Consumer:      eachEntry.Consumer,
+				Idle:          eachEntry.Idle,
+				DeliveryCount: eachEntry.RetryCount,
+			})
+		}
+	}
+	return result, nil
+}
+
+// 已经投递但未确认的消息计入Processing,stream中的其它消息计入Ready
+func (b *streamBackend) counts(ctx context.Context, stats *QueueStats) error {
+	q := b.q
+	var lenCmds []*redis.IntCmd
+	var pendingCmds []*redis.XPendingCmd
+	var oldestCmds []*redis.XMessageSliceCmd
+	_, err := q.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for priority := 0; priority < q.options.priorities; priority++ {
+			lenCmds = append(lenCmds, pipe.XLen(ctx, q.streamKey(priority)))
+			pendingCmds = append(pendingCmds, pipe.XPending(ctx, q.streamKey(priority), b.options.Group))
+			oldestCmds = append(oldestCmds, pipe.XRangeN(ctx, q.streamKey(priority), "-", "+", 1))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range lenCmds {
+		pending := pendingCmds[i].Val()
+		processing := int64(0)
+		if pending != nil {
+			processing = pending.Count
+		}
+		stats.Processing += processing
+		if ready := lenCmds[i].Val() - processing; ready > 0 {
+			stats.Ready += ready
+		}
+		for _, eachEntry := range oldestCmds[i].Val() {
+			if raw, ok := eachEntry.Values[streamMessageField].(string); ok {
+				stats.observeOldest(q, raw)
+			}
+		}
+	}
+	return nil
+}
+
+// 删除stream后重新创建消费者组
+func (b *streamBackend) purge(ctx context.Context) error {
+	keys := make([]string, 0, b.q.options.priorities)
+	for priority := 0; priority < b.q.options.priorities; priority++ {
+		keys = append(keys, b.q.streamKey(priority))
+	}
+	if err := b.q.options.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	return b.setup(ctx)
+}
+
+// XADD的裁剪参数
+func (b *streamBackend) trimArgs() []interface{} {
+	args := make([]interface{}, 0, 3)
+	if b.options.MaxLen > 0 {
+		args = append(args, "MAXLEN")
+		if !b.options.Exact {
+			args = append(args, "~")
+		}
+		return append(args, b.options.MaxLen)
+	}
+	if b.options.MinIDAge > 0 {
+		args = append(args, "MINID")
+		if !b.options.Exact {
+			args = append(args, "~")
+		}
+		return append(args, strconv.FormatInt(time.Now().Add(-b.options.MinIDAge).UnixMilli(), 10))
+	}
+	return args
+}
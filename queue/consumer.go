@@ -0,0 +1,176 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	//在指定的时间内没有消息
+	ErrNoMessage = errors.New("queue: no message")
+)
+
+// 消息处理函数
+type Handler func(ctx context.Context, msg *Message) error
+
+// 将消息放入队列，返回消息id
+// 通过WithUniqueKey指定唯一键时与EnqueueUnique相同
+func (q *Queue) Enqueue(ctx context.Context, payload interface{}, opts ...EnqueueOption) (string, error) {
+	options := q.applyEnqueueOptions(opts...)
+	msg, err := q.newEncodedMessage(payload, options)
+	if err != nil {
+		return "", err
+	}
+	if existing, err := q.lockUnique(ctx, msg, options); err != nil {
+		return existing, err
+	}
+	if err := q.backend.push(ctx, msg); err != nil {
+		msg.releaseUnique(ctx)
+		return "", err
+	}
+	q.incrStat(ctx, StatEnqueued)
+	return msg.ID, nil
+}
+
+// 序列化payload并编码为消息
+func (q *Queue) newEncodedMessage(payload interface{}, options *enqueueOptions) (*Message, error) {
+	data, err := q.options.marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	msg := newMessage(q, data)
+	msg.Priority = options.priority
+	msg.UniqueKey = options.uniqueKey
+	if _, err := msg.encode(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// 从队列中取出一条消息，最多等待timeout,为0表示一直等待
+// 消息会被标记为当前消费者正在处理，处理完成后需要调用Ack,失败时调用Nack或者Fail
+// 超时返回ErrNoMessage
+func (q *Queue) Dequeue(ctx context.Context, timeout time.Duration) (*Message, error) {
+	if err := q.startConsumer(ctx); err != nil {
+		return nil, err
+	}
+	msg, err := q.backend.dequeue(ctx, timeout)
+	if err != nil {
+		return nil, err
+	}
+	q.incrStat(ctx, StatDequeued)
+	return msg, nil
+}
+
+// 启动WithWorkers指定数量的worker处理消息，本函数会阻塞直到ctx被取消
+// handler返回nil时确认消息，否则按WithRetryPolicy重试，最终失败的消息进入死信队列
+// ctx被取消或者调用Drain后不再获取新消息，等待正在执行的handler完成后返回
+// 队列被Pause时worker暂停获取新消息，Resume后自动继续
+// handler收到的context不会随ctx取消，以便正在处理的消息能够完成
+func (q *Queue) Consume(ctx context.Context, handler Handler) error {
+	if handler == nil {
+		return errors.New("必须指定handler")
+	}
+	if err := q.startConsumer(ctx); err != nil {
+		return err
+	}
+	handlerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	loopCtx, stopLoops := context.WithCancel(ctx)
+	defer stopLoops()
+
+	q.checkPaused(ctx)
+	var loops sync.WaitGroup
+	loops.Add(3)
+	go func() {
+		defer loops.Done()
+		q.reapLoop(loopCtx)
+	}()
+	go func() {
+		defer loops.Done()
+		q.RunScheduler(loopCtx)
+	}()
+	go func() {
+		defer loops.Done()
+		q.pauseLoop(loopCtx)
+	}()
+	var workers sync.WaitGroup
+	for i := 0; i < q.options.workers; i++ {
+		if !q.addWorker() {
+			break
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer q.active.Done()
+			q.work(ctx, handlerCtx, handler)
+		}()
+	}
+	workers.Wait()
+	stopLoops()
+	loops.Wait()
+	return nil
+}
+
+// 一个worker的消息循环
+func (q *Queue) work(ctx context.Context, handlerCtx context.Context, handler Handler) {
+	for ctx.Err() == nil && !q.isDraining() {
+		if q.paused.Load() {
+			q.wait(ctx, q.options.pauseCheckInterval)
+			continue
+		}
+		msg, err := q.Dequeue(ctx, q.options.pollTimeout)
+		if err == ErrNoMessage {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			q.reportError(err)
+			//redis暂时不可用时避免空转
+			q.wait(ctx, q.options.pollTimeout)
+			continue
+		}
+		q.process(handlerCtx, msg, handler)
+	}
+}
+
+// 执行handler并根据结果确认消息，失败时按重试策略重试或者移入死信队列
+func (q *Queue) process(ctx context.Context, msg *Message, handler Handler) {
+	if err := q.handle(ctx, msg, handler); err != nil {
+		q.reportError(fmt.Errorf("queue: handle message %s failed: %w", msg.ID, err))
+		if err := msg.Fail(ctx, err); err != nil {
+			q.reportError(err)
+		}
+		return
+	}
+	if err := msg.Ack(ctx); err != nil {
+		q.reportError(err)
+	}
+}
+
+// 执行handler,handler发生panic时转换为错误
+func (q *Queue) handle(ctx context.Context, msg *Message, handler Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("queue: handler panic: %v", r)
+		}
+	}()
+	return handler(ctx, msg)
+}
+
+func (q *Queue) reportError(err error) {
+	if q.options.errCallback == nil {
+		return
+	}
+	defer func() {
+		if funcErr := recover(); funcErr != nil {
+			fmt.Println("invoke queue error callback occur panic", funcErr)
+		}
+	}()
+	q.options.errCallback(err)
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 每次读取的死信数
+const deadBatchSize = 100
+
+// 列出死信队列中的消息，start、stop与LRANGE一致，最新的消息在前
+func (q *Queue) ListDead(ctx context.Context, start, stop int64) ([]*Message, error) {
+	raws, err := q.options.client.LRange(ctx, q.deadKey(), start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*Message, 0, len(raws))
+	for _, eachRaw := range raws {
+		msg, err := decodeMessage(q, eachRaw)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// 死信队列中的消息数
+func (q *Queue) DeadCount(ctx context.Context) (int64, error) {
+	return q.options.client.LLen(ctx, q.deadKey()).Result()
+}
+
+// 将指定id的死信重新放入队列，失败次数清零
+func (q *Queue) RequeueDead(ctx context.Context, id string) error {
+	for start := int64(0); ; start += deadBatchSize {
+		raws, err := q.options.client.LRange(ctx, q.deadKey(), start, start+deadBatchSize-1).Result()
+		if err != nil {
+			return err
+		}
+		for _, eachRaw := range raws {
+			msg, err := decodeMessage(q, eachRaw)
+			if err != nil || msg.ID != id {
+				continue
+			}
+			_, err = q.requeueDead(ctx, msg)
+			return err
+		}
+		if len(raws) < deadBatchSize {
+			return ErrMessageNotFound
+		}
+	}
+}
+
+// 将所有死信重新放入队列，失败次数清零，返回放回的消息数
+func (q *Queue) RequeueAllDead(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		//从最早的消息开始处理
+		raws, err := q.options.client.LRange(ctx, q.deadKey(), -deadBatchSize, -1).Result()
+		if err != nil {
+			return total, err
+		}
+		if len(raws) <= 0 {
+			return total, nil
+		}
+		moved := 0
+		for i := len(raws) - 1; i >= 0; i-- {
+			msg, err := decodeMessage(q, raws[i])
+			if err != nil {
+				//无法解析的消息直接删除
+				q.options.client.LRem(ctx, q.deadKey(), 1, raws[i])
+				continue
+			}
+			ok, err := q.requeueDead(ctx, msg)
+			if err != nil {
+				return total, err
+			}
+			if ok {
+				moved++
+			}
+		}
+		total += moved
+		if moved == 0 {
+			//其它实例正在同时处理
+			return total, nil
+		}
+	}
+}
+
+// 清空死信队列，返回删除的消息数
+func (q *Queue) PurgeDead(ctx context.Context) (int64, error) {
+	var count *redis.IntCmd
+	_, err := q.options.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.LLen(ctx, q.deadKey())
+		pipe.Del(ctx, q.deadKey())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func (q *Queue) requeueDead(ctx context.Context, msg *Message) (bool, error) {
+	oldRaw := msg.raw
+	msg.Attempts = 0
+	msg.LastError = ""
+	if _, err := msg.encode(); err != nil {
+		return false, err
+	}
+	return q.backend.requeueDead(ctx, oldRaw, msg)
+}
@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 每次最多移动的到期消息数
+const delayedBatchSize = 100
+
+// 将消息放入队列，在at时间之后才会被处理，返回消息id
+func (q *Queue) EnqueueAt(ctx context.Context, payload interface{}, at time.Time, opts ...EnqueueOption) (string, error) {
+	if !at.After(time.Now()) {
+		return q.Enqueue(ctx, payload, opts...)
+	}
+	options := q.applyEnqueueOptions(opts...)
+	msg, err := q.newEncodedMessage(payload, options)
+	if err != nil {
+		return "", err
+	}
+	if existing, err := q.lockUnique(ctx, msg, options); err != nil {
+		return existing, err
+	}
+	err = q.options.client.ZAdd(ctx, q.delayedKey(msg.Priority), &redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: msg.raw,
+	}).Err()
+	if err != nil {
+		msg.releaseUnique(ctx)
+		return "", err
+	}
+	q.incrStat(ctx, StatEnqueued)
+	return msg.ID, nil
+}
+
+// 将消息放入队列，在delay之后才会被处理，返回消息id
+func (q *Queue) EnqueueIn(ctx context.Context, payload interface{}, delay time.Duration, opts ...EnqueueOption) (string, error) {
+	return q.EnqueueAt(ctx, payload, time.Now().Add(delay), opts...)
+}
+
+// 将已经到期的延迟消息移入待处理队列,返回移动的消息数
+// 移动在脚本中原子地执行，多个实例同时执行时每条消息只会被移动一次
+func (q *Queue) PromoteDelayed(ctx context.Context) (int, error) {
+	total := 0
+	for priority := q.options.priorities - 1; priority >= 0; priority-- {
+		for {
+			count, err := q.backend.promote(ctx, priority, time.Now(), delayedBatchSize)
+			if err != nil {
+				return total, err
+			}
+			total += count
+			if count < delayedBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// 定时将到期的延迟消息移入待处理队列,本函数会阻塞直到ctx被取消
+// Consume会自动执行，只生产消息的实例也可以单独执行，多个实例同时执行是安全的
+func (q *Queue) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(q.options.schedulerInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := q.PromoteDelayed(ctx); err != nil && ctx.Err() == nil {
+			q.reportError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// 队列中的一条消息
+type Message struct {
+	//消息id
+	ID string `json:"id"`
+	//序列化后的消息内容
+	Payload []byte `json:"payload"`
+	//入队时间
+	EnqueuedAt time.Time `json:"enqueuedAt"`
+	//已经失败的次数
+	Attempts int `json:"attempts,omitempty"`
+	//最后一次失败的错误信息
+	LastError string `json:"lastError,omitempty"`
+	//优先级
+	Priority int `json:"priority,omitempty"`
+	//唯一键
+	UniqueKey string `json:"uniqueKey,omitempty"`
+
+	queue *Queue
+	//消息在redis中的原始编码
+	raw string
+	//list模式下消息所在的processing list
+	processingKey string
+	//stream模式下消息的entry id
+	streamID string
+	//stream模式下消息所在的stream
+	streamKey string
+}
+
+func newMessage(q *Queue, payload []byte) *Message {
+	return &Message{
+		ID:         newMessageID(),
+		Payload:    payload,
+		EnqueuedAt: time.Now(),
+		queue:      q,
+	}
+}
+
+// 将消息内容反序列化到v
+func (m *Message) Unmarshal(v interface{}) error {
+	return m.queue.options.unmarshal(m.Payload, v)
+}
+
+// 编码消息，编码后的结果同时记录在raw中
+func (m *Message) encode() (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	m.raw = string(b)
+	return m.raw, nil
+}
+
+func decodeMessage(q *Queue, raw string) (*Message, error) {
+	m := &Message{}
+	if err := json.Unmarshal([]byte(raw), m); err != nil {
+		return nil, err
+	}
+	m.queue = q
+	m.raw = raw
+	return m, nil
+}
+
+// 生成随机的消息id
+func newMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
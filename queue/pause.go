@@ -0,0 +1,115 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// 暂停所有实例对队列的消费，Consume最多在pauseCheckInterval+pollTimeout后停止获取新消息
+// 暂停不影响入队，也不影响直接调用Dequeue
+func (q *Queue) Pause(ctx context.Context) error {
+	return q.options.client.Set(ctx, q.pausedKey(), time.Now().UnixMilli(), 0).Err()
+}
+
+// 恢复所有实例对队列的消费
+func (q *Queue) Resume(ctx context.Context) error {
+	return q.options.client.Del(ctx, q.pausedKey()).Err()
+}
+
+// 队列是否已经被暂停
+func (q *Queue) IsPaused(ctx context.Context) (bool, error) {
+	count, err := q.options.client.Exists(ctx, q.pausedKey()).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 指定Consume检查暂停标记的间隔
+func WithPauseCheckInterval(interval time.Duration) QueueOption {
+	return func(q *Queue) {
+		if interval > 0 {
+			q.options.pauseCheckInterval = interval
+		}
+	}
+}
+
+// 让当前实例的Consume停止获取新消息，等待正在执行的handler完成后返回
+// 调用后Consume会在所有worker退出后返回，之后再调用Consume会立即返回
+// ctx被取消时不再等待，返回ctx的错误
+func (q *Queue) Drain(ctx context.Context) error {
+	q.drainMu.Lock()
+	q.drainOnce.Do(func() {
+		close(q.draining)
+	})
+	q.drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 是否已经调用过Drain
+func (q *Queue) isDraining() bool {
+	select {
+	case <-q.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// 注册一个worker,已经调用过Drain时返回false
+func (q *Queue) addWorker() bool {
+	q.drainMu.Lock()
+	defer q.drainMu.Unlock()
+	if q.isDraining() {
+		return false
+	}
+	q.active.Add(1)
+	return true
+}
+
+// 定时检查暂停标记,直到ctx被取消
+func (q *Queue) pauseLoop(ctx context.Context) {
+	ticker := time.NewTicker(q.options.pauseCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.checkPaused(ctx)
+		}
+	}
+}
+
+func (q *Queue) checkPaused(ctx context.Context) {
+	paused, err := q.IsPaused(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			q.reportError(err)
+		}
+		return
+	}
+	q.paused.Store(paused)
+}
+
+// 等待d,ctx被取消或者调用Drain时提前返回
+func (q *Queue) wait(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-q.draining:
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// 入队参数
+type enqueueOptions struct {
+	priority int
+	//唯一键及其有效期
+	uniqueKey string
+	uniqueTTL time.Duration
+}
+
+type EnqueueOption func(o *enqueueOptions)
+
+// 指定消息的优先级，取值[0, 优先级数量-1],越大越先被处理
+// 超出范围时按最接近的优先级处理
+func WithPriority(priority int) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.priority = priority
+	}
+}
+
+func (q *Queue) applyEnqueueOptions(opts ...EnqueueOption) *enqueueOptions {
+	options := &enqueueOptions{
+		uniqueTTL: defaultUniqueTTL,
+	}
+	for _, eachOpt := range opts {
+		eachOpt(options)
+	}
+	options.priority = q.clampPriority(options.priority)
+	return options
+}
+
+// 指定优先级的数量，默认为1,即不区分优先级
+func WithPriorities(priorities int) QueueOption {
+	return func(q *Queue) {
+		if priorities > 0 {
+			q.options.priorities = priorities
+		}
+	}
+}
+
+// 启用加权公平模式，weights[i]为优先级i的权重
+// 每次取消息时先按权重随机选择一个优先级，该优先级没有消息时再按优先级从高到低依次尝试，
+// 避免低优先级的消息一直得不到处理
+func WithPriorityWeights(weights ...int) QueueOption {
+	return func(q *Queue) {
+		q.options.priorityWeights = weights
+	}
+}
+
+func (q *Queue) clampPriority(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority >= q.options.priorities {
+		return q.options.priorities - 1
+	}
+	return priority
+}
+
+// 本次取消息时尝试各优先级的顺序
+func (q *Queue) priorityOrder() []int {
+	order := make([]int, 0, q.options.priorities)
+	first := q.weightedPriority()
+	if first >= 0 {
+		order = append(order, first)
+	}
+	for p := q.options.priorities - 1; p >= 0; p-- {
+		if p != first {
+			order = append(order, p)
+		}
+	}
+	return order
+}
+
+// 按权重随机选择一个优先级，没有启用加权公平模式时返回-1
+func (q *Queue) weightedPriority() int {
+	weights := q.options.priorityWeights
+	total := 0
+	for p := 0; p < q.options.priorities && p < len(weights); p++ {
+		if weights[p] > 0 {
+			total += weights[p]
+		}
+	}
+	if total <= 0 {
+		return -1
+	}
+	n := rand.Intn(total)
+	for p := 0; p < q.options.priorities && p < len(weights); p++ {
+		if weights[p] <= 0 {
+			continue
+		}
+		if n < weights[p] {
+			return p
+		}
+		n -= weights[p]
+	}
+	return -1
+}
+
+// 指定优先级的key,优先级0使用原有的key
+func priorityKey(key string, priority int) string {
+	if priority <= 0 {
+		return key
+	}
+	return key + "::p" + strconv.Itoa(priority)
+}
+
+// 一次阻塞等待的时长，不超过priorityBlockInterval以及到deadline的剩余时间
+// timeout为0表示一直等待，此时每次阻塞priorityBlockInterval
+func priorityBlock(timeout time.Duration, deadline time.Time) time.Duration {
+	block := priorityBlockInterval
+	if timeout > 0 {
+		if remaining := time.Until(deadline); remaining < block {
+			block = remaining
+		}
+	}
+	//BLMOVE的timeout以及XREADGROUP的BLOCK为0时会一直阻塞
+	if block < time.Millisecond {
+		block = time.Millisecond
+	}
+	return block
+}
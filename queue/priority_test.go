@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newPriorityQueue(priorities int, weights ...int) *Queue {
+	return &Queue{
+		options: &queueOptions{
+			priorities:      priorities,
+			priorityWeights: weights,
+		},
+	}
+}
+
+func TestPriorityOrderStrict(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities int
+		weights    []int
+		want       []int
+	}{
+		{"single", 1, nil, []int{0}},
+		{"three", 3, nil, []int{2, 1, 0}},
+		{"zero weights", 3, []int{0, 0, 0}, []int{2, 1, 0}},
+		{"negative weights", 2, []int{-1, -5}, []int{1, 0}},
+		{"weights beyond priorities", 2, []int{0, 0, 10}, []int{1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newPriorityQueue(tt.priorities, tt.weights...)
+			if got := q.priorityOrder(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("priorityOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityOrderWeighted(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities int
+		weights    []int
+		//每个优先级作为第一个尝试的期望比例
+		want []float64
+	}{
+		{"only lowest", 3, []int{1, 0, 0}, []float64{1, 0, 0}},
+		{"even", 2, []int{1, 1}, []float64{0.5, 0.5}},
+		{"skewed", 3, []int{1, 2, 7}, []float64{0.1, 0.2, 0.7}},
+		{"missing weights", 3, []int{1, 3}, []float64{0.25, 0.75, 0}},
+	}
+	const rounds = 20000
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newPriorityQueue(tt.priorities, tt.weights...)
+			counts := make([]int, tt.priorities)
+			for i := 0; i < rounds; i++ {
+				order := q.priorityOrder()
+				if len(order) != tt.priorities {
+					t.Fatalf("priorityOrder() = %v, want %d priorities", order, tt.priorities)
+				}
+				//第一个之后按优先级从高到低
+				seen := map[int]bool{order[0]: true}
+				last := tt.priorities
+				for _, p := range order[1:] {
+					if seen[p] || p >= last {
+						t.Fatalf("priorityOrder() = %v, want the rest in descending order", order)
+					}
+					seen[p] = true
+					last = p
+				}
+				counts[order[0]]++
+			}
+			for p, want := range tt.want {
+				got := float64(counts[p]) / rounds
+				if got < want-0.03 || got > want+0.03 {
+					t.Fatalf("priority %d first in %.3f of rounds, want %.3f", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPriorityBlock(t *testing.T) {
+	tests := []struct {
+		name      string
+		timeout   time.Duration
+		remaining time.Duration
+		min, max  time.Duration
+	}{
+		{"forever", 0, 0, priorityBlockInterval, priorityBlockInterval},
+		{"long timeout", time.Minute, time.Minute, priorityBlockInterval, priorityBlockInterval},
+		{"short remaining", time.Second, 300 * time.Millisecond, 250 * time.Millisecond, 300 * time.Millisecond},
+		{"deadline passed", time.Second, -time.Second, time.Millisecond, time.Millisecond},
+		{"below minimum", time.Second, time.Microsecond, time.Millisecond, time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := priorityBlock(tt.timeout, time.Now().Add(tt.remaining))
+			if got < tt.min || got > tt.max {
+				t.Fatalf("priorityBlock() = %v, want in [%v, %v]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -4,31 +4,103 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v8"
+	redisx "github.com/shanluzhineng/redisx"
+	heartbeat "github.com/shanluzhineng/redisx/heartbeat"
+)
+
+const (
+	//队列key的前缀
+	queueKeyPrefix = "mq::queue::"
+	//所有队列名称的集合
+	defaultQueuesKey = "mq::queues"
 )
 
 type Queue struct {
 	options *queueOptions
+	backend backend
+
+	//当前消费者的id
+	consumerID   string
+	consumerOnce sync.Once
+	consumerErr  error
+	heartbeat    *heartbeat.Heartbeat
+
+	//Consume最近一次检查到的暂停标记
+	paused atomic.Bool
+	//调用Drain后关闭
+	draining  chan struct{}
+	drainOnce sync.Once
+	drainMu   sync.Mutex
+	//正在运行的worker
+	active sync.WaitGroup
 }
 
 type queueOptions struct {
-	client *redis.Client
+	client redis.UniversalClient
 	//queue name
 	queueName string
 	//key
 	queueKey string
+
+	//消息内容的序列化方式
+	marshal   redisx.MarshalFunc
+	unmarshal redisx.UnmarshalFunc
+	//Consume时并发处理消息的worker数
+	workers int
+	//Consume时每次阻塞等待消息的时长，同时也是Consume响应取消的最长延迟
+	pollTimeout time.Duration
+	//Consume过程中发生错误时的回调
+	errCallback func(err error)
+
+	//消费者id,为空时自动生成
+	consumerID string
+	//消费者心跳的间隔
+	heartbeatInterval time.Duration
+	//回收失效消费者消息的间隔
+	reapInterval time.Duration
+	//检查到期延迟消息的间隔
+	schedulerInterval time.Duration
+	//handler失败时的重试策略
+	retryPolicy RetryPolicy
+	//不为nil时使用Redis Streams存储消息
+	stream *StreamOptions
+	//优先级数量
+	priorities int
+	//加权公平模式下各优先级的权重
+	priorityWeights []int
+	//吞吐量统计的保留时间
+	statsRetention time.Duration
+	//Consume检查暂停标记的间隔
+	pauseCheckInterval time.Duration
 }
 
 func defaultQueueOptions() *queueOptions {
 	return &queueOptions{
-		queueKey: "mq::queues",
+		queueKey:    defaultQueuesKey,
+		marshal:     redisx.DefaultMarshal,
+		unmarshal:   redisx.DefaultUnmarshal,
+		workers:     1,
+		pollTimeout: time.Second,
+
+		heartbeatInterval: time.Second,
+		reapInterval:      10 * time.Second,
+		schedulerInterval: time.Second,
+		retryPolicy:       DefaultRetryPolicy(),
+		priorities:        1,
+		statsRetention:    24 * time.Hour,
+
+		pauseCheckInterval: time.Second,
 	}
 }
 
 type QueueOption func(q *Queue)
 
-func WithRedisClient(client *redis.Client) QueueOption {
+func WithRedisClient(client redis.UniversalClient) QueueOption {
 	return func(q *Queue) {
 		q.options.client = client
 	}
@@ -55,14 +127,92 @@ func WithQueueName(queueName string) QueueOption {
 	}
 }
 
+// 指定消息内容的序列化方式，默认与redisx的StringSet一致
+func WithMarshalFunc(marshal redisx.MarshalFunc, unmarshal redisx.UnmarshalFunc) QueueOption {
+	return func(q *Queue) {
+		q.options.marshal = marshal
+		q.options.unmarshal = unmarshal
+	}
+}
+
+// 指定Consume时并发处理消息的worker数
+func WithWorkers(workers int) QueueOption {
+	return func(q *Queue) {
+		if workers > 0 {
+			q.options.workers = workers
+		}
+	}
+}
+
+// 指定Consume时每次阻塞等待消息的时长
+func WithPollTimeout(pollTimeout time.Duration) QueueOption {
+	return func(q *Queue) {
+		if pollTimeout > 0 {
+			q.options.pollTimeout = pollTimeout
+		}
+	}
+}
+
+// 指定Consume过程中发生错误时的回调，包括redis错误以及handler返回的错误
+func WithErrorCallback(errCallback func(err error)) QueueOption {
+	return func(q *Queue) {
+		q.options.errCallback = errCallback
+	}
+}
+
+// 指定消费者id,同一个id重启后可以继续使用原有的processing list
+// 不指定时每个Queue实例自动生成一个随机id
+func WithConsumerID(consumerID string) QueueOption {
+	return func(q *Queue) {
+		q.options.consumerID = consumerID
+	}
+}
+
+// 指定消费者心跳的间隔，心跳超过3个间隔未更新的消费者会被视为已失效
+func WithHeartbeatInterval(interval time.Duration) QueueOption {
+	return func(q *Queue) {
+		if interval > 0 {
+			q.options.heartbeatInterval = interval
+		}
+	}
+}
+
+// 指定Consume时回收失效消费者消息的间隔
+func WithReapInterval(interval time.Duration) QueueOption {
+	return func(q *Queue) {
+		if interval > 0 {
+			q.options.reapInterval = interval
+		}
+	}
+}
+
+// 指定检查到期延迟消息的间隔，即延迟消息最多晚于到期时间多久被处理
+func WithSchedulerInterval(interval time.Duration) QueueOption {
+	return func(q *Queue) {
+		if interval > 0 {
+			q.options.schedulerInterval = interval
+		}
+	}
+}
+
 // new a queue
 func NewQueue(opts ...QueueOption) (*Queue, error) {
 	queue := &Queue{
-		options: defaultQueueOptions(),
+		options:  defaultQueueOptions(),
+		draining: make(chan struct{}),
 	}
 	for _, eachOpt := range opts {
 		eachOpt(queue)
 	}
+	queue.consumerID = queue.options.consumerID
+	if len(queue.consumerID) <= 0 {
+		queue.consumerID = newMessageID()
+	}
+	if queue.options.stream != nil {
+		queue.backend = newStreamBackend(queue, queue.options.stream)
+	} else {
+		queue.backend = newListBackend(queue)
+	}
 	err := setupQueue(queue)
 	if err != nil {
 		return nil, err
@@ -82,5 +232,55 @@ func setupQueue(q *Queue) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return q.backend.setup(context)
+}
+
+// 队列中各个key的前缀，使用hash tag确保Cluster模式下同一个队列的key位于同一个slot
+func (q *Queue) baseKey() string {
+	return queueKeyPrefix + "{" + q.options.queueName + "}"
+}
+
+// 指定优先级的待处理消息list
+func (q *Queue) readyKey(priority int) string {
+	return priorityKey(q.baseKey(), priority)
+}
+
+// 队列名称
+func (q *Queue) Name() string {
+	return q.options.queueName
+}
+
+// 消费者正在处理的消息list
+func (q *Queue) processingKey(consumerID string) string {
+	return q.baseKey() + "::processing::" + consumerID
+}
+
+// 消费者的心跳key
+func (q *Queue) heartbeatKey(consumerID string) string {
+	return q.baseKey() + "::consumer::" + consumerID + "::heartbeat"
+}
+
+// 所有消费者id的集合
+func (q *Queue) consumersKey() string {
+	return q.baseKey() + "::consumers"
+}
+
+// stream模式下存储指定优先级消息的stream
+func (q *Queue) streamKey(priority int) string {
+	return priorityKey(q.baseKey()+"::stream", priority)
+}
+
+// 指定优先级的延迟消息有序集合，score为到期时间(毫秒)
+func (q *Queue) delayedKey(priority int) string {
+	return priorityKey(q.baseKey()+"::delayed", priority)
+}
+
+// 最终失败的消息list
+func (q *Queue) deadKey() string {
+	return q.baseKey() + "::dead"
+}
+
+// 暂停消费的标记
+func (q *Queue) pausedKey() string {
+	return q.baseKey() + "::paused"
 }
@@ -0,0 +1,91 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	heartbeat "github.com/shanluzhineng/redisx/heartbeat"
+)
+
+var (
+	//消息已经被确认或者已经被回收
+	ErrMessageNotFound = errors.New("queue: message not found in processing list")
+)
+
+// 心跳key的有效期为几个心跳间隔
+const heartbeatExpirationFactor = 3
+
+// 注册当前消费者并开始发送心跳，只会执行一次
+func (q *Queue) startConsumer(ctx context.Context) error {
+	q.consumerOnce.Do(func() {
+		expiration := q.options.heartbeatInterval * heartbeatExpirationFactor
+		heartbeatKey := q.heartbeatKey(q.consumerID)
+		//先同步写入心跳，避免取到消息后被其它实例当作失效消费者回收
+		err := q.options.client.Set(ctx, heartbeatKey, "ok", expiration).Err()
+		if err == nil {
+			err = q.options.client.SAdd(ctx, q.consumersKey(), q.consumerID).Err()
+		}
+		if err != nil {
+			q.consumerErr = err
+			return
+		}
+		q.heartbeat = heartbeat.NewHeartbeat(q.options.client, heartbeat.Options{
+			Interval:     q.options.heartbeatInterval,
+			HeartbeatKey: heartbeatKey,
+			Expiration:   expiration,
+		})
+		go q.heartbeat.Start(func(err heartbeat.HeartbeatError) {
+			q.reportError(err.RedisError)
+		})
+	})
+	return q.consumerErr
+}
+
+// 停止心跳并注销当前消费者
+// 当前消费者processing list中未确认的消息会由其它消费者的Reap移回ready list
+func (q *Queue) Close() error {
+	if q.heartbeat == nil {
+		return nil
+	}
+	err := q.heartbeat.Stop()
+	q.heartbeat = nil
+	return err
+}
+
+// 确认消息已经处理完成，同时释放消息占用的唯一键
+func (m *Message) Ack(ctx context.Context) error {
+	if err := m.queue.backend.ack(ctx, m); err != nil {
+		return err
+	}
+	m.queue.incrStat(ctx, StatAcked)
+	return m.releaseUnique(ctx)
+}
+
+// 消息处理失败，将其立即放回队列等待重新处理
+func (m *Message) Nack(ctx context.Context) error {
+	return m.queue.backend.nack(ctx, m)
+}
+
+// 回收已经失效的消费者正在处理的消息，多个实例同时执行是安全的
+// list模式下根据消费者心跳判断是否失效，返回回收的消息数
+// stream模式下空闲的消息由Dequeue通过XAUTOCLAIM认领，本函数只删除已经失效并且没有未确认消息的组内消费者，返回删除的消费者数
+func (q *Queue) Reap(ctx context.Context) (int, error) {
+	return q.backend.reap(ctx)
+}
+
+// 定时执行Reap,直到ctx被取消
+func (q *Queue) reapLoop(ctx context.Context) {
+	ticker := time.NewTicker(q.options.reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := q.Reap(ctx); err != nil && ctx.Err() == nil {
+			q.reportError(err)
+		}
+	}
+}
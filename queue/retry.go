@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// handler失败时的重试策略
+type RetryPolicy struct {
+	//最多执行的次数(包括第一次),小于等于1表示不重试
+	MaxAttempts int
+	//第一次重试前的等待时间
+	Delay time.Duration
+	//重试前的最大等待时间，为0表示不限制
+	MaxDelay time.Duration
+	//是否按指数增长等待时间，否则每次都等待Delay
+	Exponential bool
+	//随机抖动的比例，取值[0,1],如0.2表示在等待时间上随机增减20%
+	Jitter float64
+}
+
+// 默认的重试策略:最多执行3次，从1秒开始按指数增长，最大1分钟，带20%的随机抖动
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Delay:       time.Second,
+		MaxDelay:    time.Minute,
+		Exponential: true,
+		Jitter:      0.2,
+	}
+}
+
+// 指定handler失败时的重试策略
+func WithRetryPolicy(policy RetryPolicy) QueueOption {
+	return func(q *Queue) {
+		q.options.retryPolicy = policy
+	}
+}
+
+// 计算第attempts次失败后的等待时间
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.Delay
+	if p.Exponential {
+		for i := 1; i < attempts && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+			d *= 2
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		delta := float64(d) * p.Jitter
+		d += time.Duration(delta*2*rand.Float64() - delta)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// 消息处理失败，记录失败次数及错误
+// 未达到最大次数时按重试策略延迟后重新处理，否则移入死信队列
+func (m *Message) Fail(ctx context.Context, cause error) error {
+	q := m.queue
+	retry := *m
+	retry.Attempts++
+	if cause != nil {
+		retry.LastError = cause.Error()
+	}
+	raw, err := retry.encode()
+	if err != nil {
+		return err
+	}
+	if retry.Attempts < q.options.retryPolicy.MaxAttempts {
+		dueAt := time.Now().Add(q.options.retryPolicy.backoff(retry.Attempts))
+		if err := q.backend.retry(ctx, m, raw, dueAt); err != nil {
+			return err
+		}
+		q.incrStat(ctx, StatFailed)
+		return nil
+	}
+	return m.bury(ctx, raw)
+}
+
+// 将消息以新的编码raw移入死信队列
+func (m *Message) bury(ctx context.Context, raw string) error {
+	q := m.queue
+	if err := q.backend.bury(ctx, m, raw); err != nil {
+		return err
+	}
+	q.incrStat(ctx, StatFailed)
+	//最终失败后释放唯一键，相同唯一键的消息可以再次入队
+	return m.releaseUnique(ctx)
+}
@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{"fixed", RetryPolicy{Delay: time.Second}, 3, time.Second},
+		{"exponential first", RetryPolicy{Delay: time.Second, Exponential: true}, 1, time.Second},
+		{"exponential third", RetryPolicy{Delay: time.Second, Exponential: true}, 3, 4 * time.Second},
+		{"exponential capped", RetryPolicy{Delay: time.Second, MaxDelay: 5 * time.Second, Exponential: true}, 4, 5 * time.Second},
+		{"exponential many attempts", RetryPolicy{Delay: time.Second, MaxDelay: time.Minute, Exponential: true}, 1000, time.Minute},
+		{"delay above max", RetryPolicy{Delay: time.Minute, MaxDelay: time.Second}, 1, time.Second},
+		{"zero delay", RetryPolicy{Exponential: true, Jitter: 0.5}, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempts); got != tt.want {
+				t.Fatalf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempts int
+		min, max time.Duration
+	}{
+		{"fixed", RetryPolicy{Delay: time.Second, Jitter: 0.2}, 1, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{"exponential", RetryPolicy{Delay: time.Second, Exponential: true, Jitter: 0.5}, 3, 2 * time.Second, 6 * time.Second},
+		{"capped", RetryPolicy{Delay: time.Second, MaxDelay: 2 * time.Second, Exponential: true, Jitter: 0.1}, 10, 1800 * time.Millisecond, 2200 * time.Millisecond},
+		{"full jitter", RetryPolicy{Delay: time.Second, Jitter: 1}, 1, 0, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got := tt.policy.backoff(tt.attempts)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %v, want in [%v, %v]", tt.attempts, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// 记录retry与bury调用的backend
+type recordingBackend struct {
+	backend
+	retried []time.Time
+	buried  []string
+}
+
+func (b *recordingBackend) retry(ctx context.Context, m *Message, raw string, dueAt time.Time) error {
+	b.retried = append(b.retried, dueAt)
+	return nil
+}
+
+func (b *recordingBackend) bury(ctx context.Context, m *Message, raw string) error {
+	b.buried = append(b.buried, raw)
+	return nil
+}
+
+// 忽略统计计数的client
+type discardClient struct {
+	redis.UniversalClient
+}
+
+func (c *discardClient) Pipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return nil, nil
+}
+
+func TestMessageFail(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		attempts    int
+		wantRetried bool
+	}{
+		{"first failure", 3, 0, true},
+		{"last retry", 3, 1, true},
+		{"max attempts reached", 3, 2, false},
+		{"no retry", 1, 0, false},
+		{"zero max attempts", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &recordingBackend{}
+			q := &Queue{
+				options: &queueOptions{
+					client:      &discardClient{},
+					queueName:   "test",
+					retryPolicy: RetryPolicy{MaxAttempts: tt.maxAttempts, Delay: time.Minute},
+				},
+				backend: b,
+			}
+			m := newMessage(q, []byte("payload"))
+			m.Attempts = tt.attempts
+			before := time.Now()
+			if err := m.Fail(context.Background(), errors.New("boom")); err != nil {
+				t.Fatalf("Fail() error = %v", err)
+			}
+			if tt.wantRetried {
+				if len(b.retried) != 1 || len(b.buried) != 0 {
+					t.Fatalf("retried %d, buried %d, want a single retry", len(b.retried), len(b.buried))
+				}
+				if b.retried[0].Before(before.Add(time.Minute)) {
+					t.Fatalf("dueAt = %v, want at least %v", b.retried[0], before.Add(time.Minute))
+				}
+				return
+			}
+			if len(b.retried) != 0 || len(b.buried) != 1 {
+				t.Fatalf("retried %d, buried %d, want a single bury", len(b.retried), len(b.buried))
+			}
+			dead, err := decodeMessage(q, b.buried[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dead.Attempts != tt.attempts+1 || dead.LastError != "boom" {
+				t.Fatalf("buried attempts = %d, lastError = %q", dead.Attempts, dead.LastError)
+			}
+		})
+	}
+}
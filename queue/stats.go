@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 统计的事件
+const (
+	StatEnqueued = "enqueued"
+	StatDequeued = "dequeued"
+	StatAcked    = "acked"
+	StatFailed   = "failed"
+)
+
+const (
+	//吞吐量统计的时间粒度
+	statsBucketSize = time.Minute
+	//Stats返回的吞吐量统计的桶数
+	statsBuckets = 60
+)
+
+// 队列的统计信息
+type QueueStats struct {
+	Name string
+	//待处理的消息数
+	Ready int64
+	//延迟中(包括等待重试)的消息数
+	Delayed int64
+	//已取出但未确认的消息数
+	Processing int64
+	//死信数
+	Dead int64
+	//最早的一条待处理或者处理中消息的等待时间
+	OldestMessageAge time.Duration
+	//是否已经被Pause
+	Paused bool
+	//最近每分钟的入队、出队、确认、失败数，按时间从早到晚排列
+	Enqueued []ThroughputBucket
+	Dequeued []ThroughputBucket
+	Acked    []ThroughputBucket
+	Failed   []ThroughputBucket
+}
+
+// 一个时间段内的事件数
+type ThroughputBucket struct {
+	Time  time.Time
+	Count int64
+}
+
+// 列出所有通过NewQueue注册过的队列名称
+func ListQueues(ctx context.Context, client redis.UniversalClient) ([]string, error) {
+	return client.SMembers(ctx, defaultQueuesKey).Result()
+}
+
+// 指定吞吐量统计的保留时间，默认为24小时
+func WithStatsRetention(retention time.Duration) QueueOption {
+	return func(q *Queue) {
+		if retention > 0 {
+			q.options.statsRetention = retention
+		}
+	}
+}
+
+// 获取队列的统计信息
+func (q *Queue) Stats(ctx context.Context) (*QueueStats, error) {
+	stats := &QueueStats{
+		Name: q.options.queueName,
+	}
+	if err := q.backend.counts(ctx, stats); err != nil {
+		return nil, err
+	}
+	var delayedCmds []*redis.IntCmd
+	var deadCmd, pausedCmd *redis.IntCmd
+	_, err := q.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for priority := 0; priority < q.options.priorities; priority++ {
+			delayedCmds = append(delayedCmds, pipe.ZCard(ctx, q.delayedKey(priority)))
+		}
+		deadCmd = pipe.LLen(ctx, q.deadKey())
+		pausedCmd = pipe.Exists(ctx, q.pausedKey())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, eachCmd := range delayedCmds {
+		stats.Delayed += eachCmd.Val()
+	}
+	stats.Dead = deadCmd.Val()
+	stats.Paused = pausedCmd.Val() > 0
+
+	for event, buckets := range map[string]*[]ThroughputBucket{
+		StatEnqueued: &stats.Enqueued,
+		StatDequeued: &stats.Dequeued,
+		StatAcked:    &stats.Acked,
+		StatFailed:   &stats.Failed,
+	} {
+		if *buckets, err = q.Throughput(ctx, event, statsBuckets); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// 获取最近buckets分钟内每分钟的事件数，按时间从早到晚排列
+func (q *Queue) Throughput(ctx context.Context, event string, buckets int) ([]ThroughputBucket, error) {
+	now := time.Now().Truncate(statsBucketSize)
+	times := make([]time.Time, 0, buckets)
+	keys := make([]string, 0, buckets)
+	for i := buckets - 1; i >= 0; i-- {
+		t := now.Add(-time.Duration(i) * statsBucketSize)
+		times = append(times, t)
+		keys = append(keys, q.statsKey(event, t))
+	}
+	result := make([]ThroughputBucket, 0, buckets)
+	if len(keys) <= 0 {
+		return result, nil
+	}
+	//每个key单独GET,避免Cluster模式下MGET的限制
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	_, err := q.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, eachKey := range keys {
+			cmds = append(cmds, pipe.Get(ctx, eachKey))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, eachCmd := range cmds {
+		count, _ := eachCmd.Int64()
+		result = append(result, ThroughputBucket{
+			Time:  times[i],
+			Count: count,
+		})
+	}
+	return result, nil
+}
+
+// 清空队列中的所有消息，包括待处理、延迟、处理中的消息以及死信，同时释放所有唯一键
+func (q *Queue) PurgeQueue(ctx context.Context) error {
+	keys := []string{q.deadKey()}
+	for priority := 0; priority < q.options.priorities; priority++ {
+		keys = append(keys, q.delayedKey(priority))
+	}
+	if err := q.options.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	if err := q.purgeUnique(ctx); err != nil {
+		return err
+	}
+	return q.backend.purge(ctx)
+}
+
+// 清空队列并从队列注册表中删除，吞吐量统计的key会在保留时间后自动过期
+func (q *Queue) DeleteQueue(ctx context.Context) error {
+	if err := q.PurgeQueue(ctx); err != nil {
+		return err
+	}
+	//stream后端清空后会重新创建stream,删除队列时一并删除
+	keys := []string{q.consumersKey(), q.pausedKey()}
+	for priority := 0; priority < q.options.priorities; priority++ {
+		keys = append(keys, q.streamKey(priority))
+	}
+	if err := q.options.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+	return q.options.client.SRem(ctx, q.options.queueKey, q.options.queueName).Err()
+}
+
+// 根据消息的入队时间更新最早消息的等待时间
+func (stats *QueueStats) observeOldest(q *Queue, raw string) {
+	msg, err := decodeMessage(q, raw)
+	if err != nil || msg.EnqueuedAt.IsZero() {
+		return
+	}
+	if age := time.Since(msg.EnqueuedAt); age > stats.OldestMessageAge {
+		stats.OldestMessageAge = age
+	}
+}
+
+// 记录一次事件
+func (q *Queue) incrStat(ctx context.Context, event string) {
+	key := q.statsKey(event, time.Now().Truncate(statsBucketSize))
+	_, err := q.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.IncrBy(ctx, key, 1)
+		pipe.Expire(ctx, key, q.options.statsRetention)
+		return nil
+	})
+	if err != nil {
+		q.reportError(err)
+	}
+}
+
+// 指定事件及时间段的计数key
+func (q *Queue) statsKey(event string, bucket time.Time) string {
+	return q.baseKey() + "::stats::" + event + "::" + strconv.FormatInt(bucket.Unix(), 10)
+}
@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	//相同唯一键的消息还在等待处理或者正在处理
+	ErrDuplicateMessage = errors.New("queue: duplicate message")
+)
+
+// 唯一键的默认有效期
+const defaultUniqueTTL = time.Hour
+
+// 清空队列时每批删除的唯一键数量
+const uniquePurgeBatch = 500
+
+const (
+	//占用唯一键，并以过期时间为score记录到唯一键有序集合中，同时移除集合中已经过期的唯一键
+	//ARGV[2]为有效期(毫秒),ARGV[3]为当前时间(毫秒)
+	uniqueLockCommand = `if not redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 0
+end
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", ARGV[3])
+redis.call("ZADD", KEYS[2], tonumber(ARGV[3]) + tonumber(ARGV[2]), KEYS[1])
+return 1`
+
+	//唯一键仍然属于指定的消息时才删除
+	uniqueReleaseCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("ZREM", KEYS[2], KEYS[1])
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+)
+
+// 指定消息的唯一键，相同唯一键的消息在确认、最终失败或者唯一键过期之前只能入队一次
+func WithUniqueKey(uniqueKey string) EnqueueOption {
+	return func(o *enqueueOptions) {
+		o.uniqueKey = uniqueKey
+	}
+}
+
+// 指定唯一键的有效期，默认为1小时
+// 有效期应大于消息从入队到处理完成的最长时间，过期后相同唯一键的消息可以再次入队
+func WithUniqueTTL(ttl time.Duration) EnqueueOption {
+	return func(o *enqueueOptions) {
+		if ttl > 0 {
+			o.uniqueTTL = ttl
+		}
+	}
+}
+
+// 将消息放入队列，必须通过WithUniqueKey指定唯一键
+// 相同唯一键的消息还在等待处理或者正在处理时不会入队，返回已有消息的id以及ErrDuplicateMessage,
+// 调用方可以忽略该错误以合并重复的消息
+func (q *Queue) EnqueueUnique(ctx context.Context, payload interface{}, opts ...EnqueueOption) (string, error) {
+	if len(q.applyEnqueueOptions(opts...).uniqueKey) <= 0 {
+		return "", errors.New("必须指定uniqueKey")
+	}
+	return q.Enqueue(ctx, payload, opts...)
+}
+
+// 以消息id占用唯一键，已经被其它消息占用时返回其id以及ErrDuplicateMessage
+// 未指定唯一键时不做处理
+func (q *Queue) lockUnique(ctx context.Context, msg *Message, options *enqueueOptions) (string, error) {
+	if len(msg.UniqueKey) <= 0 {
+		return "", nil
+	}
+	key := q.uniqueKey(msg.UniqueKey)
+	locked, err := q.options.client.Eval(ctx, uniqueLockCommand, []string{key, q.uniquesKey()}, msg.ID,
+		options.uniqueTTL.Milliseconds(), time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return "", err
+	}
+	if locked == 1 {
+		return "", nil
+	}
+	existing, err := q.options.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		//刚好过期或者被释放，重新尝试
+		return q.lockUnique(ctx, msg, options)
+	}
+	if err != nil {
+		return "", err
+	}
+	return existing, ErrDuplicateMessage
+}
+
+// 释放消息占用的唯一键，唯一键已经过期并被其它消息占用时不做处理
+func (m *Message) releaseUnique(ctx context.Context) error {
+	if len(m.UniqueKey) <= 0 {
+		return nil
+	}
+	q := m.queue
+	return q.options.client.Eval(ctx, uniqueReleaseCommand, []string{q.uniqueKey(m.UniqueKey), q.uniquesKey()}, m.ID).Err()
+}
+
+// 删除队列所有的唯一键
+func (q *Queue) purgeUnique(ctx context.Context) error {
+	uniquesKey := q.uniquesKey()
+	for {
+		keys, err := q.options.client.ZRange(ctx, uniquesKey, 0, uniquePurgeBatch-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) <= 0 {
+			return nil
+		}
+		members := make([]interface{}, 0, len(keys))
+		for _, eachKey := range keys {
+			members = append(members, eachKey)
+		}
+		//唯一键与有序集合使用相同的hash tag,位于同一个slot
+		_, err = q.options.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, keys...)
+			pipe.ZRem(ctx, uniquesKey, members...)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 唯一键
+func (q *Queue) uniqueKey(uniqueKey string) string {
+	return q.baseKey() + "::unique::" + uniqueKey
+}
+
+// 记录所有唯一键的有序集合，score为唯一键的过期时间
+func (q *Queue) uniquesKey() string {
+	return q.baseKey() + "::uniques"
+}
@@ -0,0 +1,302 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+var errLoaderPanic = errors.New("redis: loader panicked")
+
+const (
+	//记录上次重建耗时的key后缀
+	rebuildDeltaKeySuffix = "::delta"
+	//旧值副本的key后缀
+	staleKeySuffix = "::stale"
+	//重建锁的key后缀
+	rebuildLockKeySuffix = "::rebuild"
+	//墓碑值单独存放时的key后缀
+	absentKeySuffix = "::absent"
+	//未获取到重建锁时轮询新值的间隔
+	rebuildPollInterval = 50 * time.Millisecond
+)
+
+// 缓存未命中时用于加载数据的函数
+type LoaderFunc func(ctx context.Context) (interface{}, error)
+
+// cache-aside模式的一次读取
+type cacheAside struct {
+	client  redis.UniversalClient
+	options *RedisValueOptions
+	//值所在的key
+	key string
+	//进程内singleflight使用的key,包含值的类型，避免string与hash field的key相同，见stringFlightKey和hashFlightKey
+	flightKey string
+	//重建锁、旧值副本等辅助key的前缀，与值所在的key使用相同的前缀，便于按前缀扫描、删除
+	auxKey string
+	//从redis读取
+	get func() IRedisValue
+	//将marshal后的数据写入redis
+	set func(pipe redis.Pipeliner, data []byte, ttl time.Duration)
+	//墓碑值是否单独存放在auxKey::absent中,用于无法单独设置有效期的hash field
+	separateTombstone bool
+	//获取剩余的有效期
+	ttl func() *time.Duration
+}
+
+// 从redis读取值，如果不存在则调用loader加载并写入redis
+// 同一进程内对同一个key的并发加载会被合并为一次loader调用
+func (c *cacheAside) getOrLoad(group *flightGroup, loader LoaderFunc) IRedisValue {
+	v := c.lookup()
+	if v.Err() != nil || v.IsAbsent() || loader == nil {
+		return v
+	}
+	if v.Exist() {
+		if !c.shouldRefreshEarly() {
+			return v
+		}
+		//提前重建,未抢到重建锁时继续使用当前值
+		return group.Do(c.flightKey, func() IRedisValue {
+			return c.refresh(v, loader)
+		})
+	}
+	if !c.options.loadIfEmpty {
+		return v
+	}
+	return group.Do(c.flightKey, func() IRedisValue {
+		//可能在等待期间已经被其它调用写入
+		v := c.lookup()
+		if isCached(v) {
+			return v
+		}
+		return c.rebuild(loader)
+	})
+}
+
+// 未命中时重建
+// 如果启用了重建锁，只有获取到锁的调用方会执行loader,其它调用方优先使用旧值副本,
+// 否则等待新值写入，等待超时后自行加载
+func (c *cacheAside) rebuild(loader LoaderFunc) IRedisValue {
+	if c.options.rebuildLockTTL <= 0 {
+		return c.load(loader)
+	}
+	lock := c.rebuildLock()
+	ok, err := lock.TryLock(c.options.ctx)
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	if ok {
+		defer lock.RedisRelease(c.options.ctx)
+		//获取锁期间可能已经有其它实例完成了重建
+		if v := c.lookup(); isCached(v) {
+			return v
+		}
+		return c.load(loader)
+	}
+	if stale := c.getStale(); stale.Exist() {
+		return stale
+	}
+	deadline := time.Now().Add(c.options.rebuildLockTTL)
+	for time.Now().Before(deadline) {
+		select {
+		case <-c.options.ctx.Done():
+			return newErrRedisValue(c.options.ctx.Err())
+		case <-time.After(rebuildPollInterval):
+		}
+		if v := c.lookup(); isCached(v) {
+			return v
+		}
+	}
+	//持有锁的实例可能已经退出
+	return c.load(loader)
+}
+
+// 提前重建,没有获取到重建锁时返回当前值
+func (c *cacheAside) refresh(current IRedisValue, loader LoaderFunc) IRedisValue {
+	if c.options.rebuildLockTTL <= 0 {
+		return c.reloadOrStale(current, loader)
+	}
+	lock := c.rebuildLock()
+	ok, err := lock.TryLock(c.options.ctx)
+	if err != nil || !ok {
+		return current
+	}
+	defer lock.RedisRelease(c.options.ctx)
+	return c.reloadOrStale(current, loader)
+}
+
+// 提前重建失败时仍然返回当前值
+func (c *cacheAside) reloadOrStale(current IRedisValue, loader LoaderFunc) IRedisValue {
+	v := c.load(loader)
+	if v.Err() != nil {
+		return current
+	}
+	return v
+}
+
+// 读取值，如果墓碑值单独存放，未命中时再检查墓碑值
+func (c *cacheAside) lookup() IRedisValue {
+	v := c.get()
+	if !c.separateTombstone || isCached(v) {
+		return v
+	}
+	n, err := c.client.Exists(c.options.ctx, c.auxKey+absentKeySuffix).Result()
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	if n > 0 {
+		return newAbsentRedisValue()
+	}
+	return v
+}
+
+// 值已经缓存(包括被缓存为不存在)或者读取出错
+func isCached(v IRedisValue) bool {
+	return v.Err() != nil || v.Exist() || v.IsAbsent()
+}
+
+// 调用loader并将结果写入redis
+func (c *cacheAside) load(loader LoaderFunc) IRedisValue {
+	start := time.Now()
+	value, err := loader(c.options.ctx)
+	if errors.Is(err, ErrKeyNotExist) {
+		return c.storeTombstone()
+	}
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	if value == nil {
+		return newNilRedisValue()
+	}
+	data, err := c.options.marshal(value)
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	delta := time.Since(start)
+
+	ctx := c.options.ctx
+	ttl := c.options.getTTL()
+	_, err = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		c.set(pipe, data, ttl)
+		c.options.addTags(pipe, c.key, ttl)
+		if c.separateTombstone && c.options.negativeTTL > 0 {
+			pipe.Del(ctx, c.auxKey+absentKeySuffix)
+		}
+		if c.options.earlyRefreshBeta > 0 {
+			pipe.Set(ctx, c.auxKey+rebuildDeltaKeySuffix, delta.Milliseconds(), ttl)
+		}
+		if c.options.staleTTL > 0 {
+			staleTTL := Redis_NoExpiration_TTL
+			if ttl > 0 {
+				staleTTL = ttl + c.options.staleTTL
+			}
+			pipe.Set(ctx, c.auxKey+staleKeySuffix, data, staleTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	return newRedisValue(data, c.options.unmarshal).withTTL(ttl)
+}
+
+// loader确认数据不存在时，按negativeTTL写入墓碑值
+func (c *cacheAside) storeTombstone() IRedisValue {
+	if c.options.negativeTTL <= 0 {
+		return newNilRedisValue()
+	}
+	ctx := c.options.ctx
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		if c.separateTombstone {
+			pipe.Set(ctx, c.auxKey+absentKeySuffix, tombstone, c.options.negativeTTL)
+		} else {
+			c.set(pipe, tombstone, c.options.negativeTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	return newAbsentRedisValue().withTTL(c.options.negativeTTL)
+}
+
+// XFetch算法:根据剩余有效期与上次重建的耗时，概率性地决定是否提前重建
+// 剩余有效期越短、重建越慢，提前重建的概率越大
+func (c *cacheAside) shouldRefreshEarly() bool {
+	if c.options.earlyRefreshBeta <= 0 {
+		return false
+	}
+	ttl := c.ttl()
+	if ttl == nil || *ttl <= 0 {
+		//key不存在或者没有过期时间
+		return false
+	}
+	deltaMs, err := c.client.Get(c.options.ctx, c.auxKey+rebuildDeltaKeySuffix).Int64()
+	if err != nil || deltaMs <= 0 {
+		return false
+	}
+	delta := float64(deltaMs) * float64(time.Millisecond)
+	gap := -delta * c.options.earlyRefreshBeta * math.Log(1-rand.Float64())
+	return gap >= float64(*ttl)
+}
+
+// 读取旧值副本
+func (c *cacheAside) getStale() IRedisValue {
+	if c.options.staleTTL <= 0 {
+		return newNilRedisValue()
+	}
+	b, err := c.client.Get(c.options.ctx, c.auxKey+staleKeySuffix).Bytes()
+	if err != nil {
+		return newNilRedisValue()
+	}
+	return newRedisValue(b, c.options.unmarshal)
+}
+
+func (c *cacheAside) rebuildLock() *RedisLock {
+	seconds := uint32(math.Ceil(c.options.rebuildLockTTL.Seconds()))
+	return NewRedisLock(c.client, c.auxKey+rebuildLockKeySuffix, randomToken(RedisRandLen), seconds)
+}
+
+// 重建缓存时使用分布式锁，只有一个实例执行loader
+// lockTTL为锁的有效期，未获取到锁的调用方最多等待lockTTL
+func WithRebuildLock(lockTTL time.Duration) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.rebuildLockTTL = lockTTL
+	}
+}
+
+// 在值过期后再保留一份旧值副本staleTTL时间，重建期间其它调用方返回该副本
+func WithStaleTTL(staleTTL time.Duration) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.staleTTL = staleTTL
+	}
+}
+
+// loader返回ErrKeyNotExist时写入墓碑值，在negativeTTL内的读取不再调用loader
+// 可以通过IRedisValue.IsAbsent判断值是否被缓存为不存在
+func WithNegativeTTL(negativeTTL time.Duration) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.negativeTTL = negativeTTL
+	}
+}
+
+// 启用XFetch提前重建,beta越大越倾向于提前重建,通常取1
+func WithEarlyRefresh(beta float64) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.earlyRefreshBeta = beta
+	}
+}
+
+// string类型的singleflight key
+func stringFlightKey(key string) string {
+	return "s:" + key
+}
+
+// hash field的singleflight key,以\x00分隔key与field,避免与其它key、field的组合相同
+func hashFlightKey(key string, field string) string {
+	return "h:" + key + "\x00" + field
+}
@@ -0,0 +1,406 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	//失效单个key的消息前缀
+	invalidateKeyMessagePrefix = "k:"
+	//清空整个本地缓存的消息
+	invalidateAllMessage = "*"
+)
+
+// 本地缓存配置
+type LocalCacheOptions struct {
+	//最大项数，为0时使用默认值10000,小于0表示不限制
+	MaxEntries int
+	//最大字节数，为0时使用默认值64MB,小于0表示不限制
+	MaxBytes int64
+	//本地缓存项的最长有效期，同时也是错过失效消息时数据不一致的最长时间
+	//redis中key的剩余有效期更短时以其为准，为0时使用默认值1分钟，小于0表示不限制
+	TTL time.Duration
+	//发布失效消息的channel,为空时使用默认值
+	InvalidationChannel string
+}
+
+// 本地缓存统计信息
+type LocalCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+// 在IRedisService前加一层进程内的LRU缓存
+// StringGet、StringMGet、StringGetOrLoad优先从本地缓存读取，
+// 所有写操作都会在redis channel上发布失效消息，每个实例收到消息后删除本地对应的项
+type LocalCacheService struct {
+	IRedisService
+
+	options      *RedisOptions
+	cacheOptions *LocalCacheOptions
+	cache        *localCache
+	pubsub       *redis.PubSub
+	done         chan struct{}
+
+	hits   uint64
+	misses uint64
+}
+
+var _ IRedisService = (*LocalCacheService)(nil)
+
+// 创建带本地缓存的IRedisService,并开始订阅失效消息
+// 不再使用时需要调用Close
+func NewLocalCacheService(options *RedisOptions, opts ...LocalCacheOptions) *LocalCacheService {
+	cacheOptions := &LocalCacheOptions{
+		MaxEntries:          10000,
+		MaxBytes:            64 << 20,
+		TTL:                 time.Minute,
+		InvalidationChannel: "redisx::localcache::invalidate",
+	}
+	//只覆盖指定了的配置
+	if len(opts) > 0 {
+		if opts[0].MaxEntries != 0 {
+			cacheOptions.MaxEntries = opts[0].MaxEntries
+		}
+		if opts[0].MaxBytes != 0 {
+			cacheOptions.MaxBytes = opts[0].MaxBytes
+		}
+		if opts[0].TTL != 0 {
+			cacheOptions.TTL = opts[0].TTL
+		}
+		if len(opts[0].InvalidationChannel) > 0 {
+			cacheOptions.InvalidationChannel = opts[0].InvalidationChannel
+		}
+	}
+	s := &LocalCacheService{
+		IRedisService: NewRedisService(options),
+		options:       options,
+		cacheOptions:  cacheOptions,
+		cache:         newLocalCache(cacheOptions.MaxEntries, cacheOptions.MaxBytes, cacheOptions.TTL),
+		done:          make(chan struct{}),
+	}
+	s.pubsub = options.client.Subscribe(context.TODO(), cacheOptions.InvalidationChannel)
+	go s.receiveInvalidations()
+	return s
+}
+
+// 停止订阅失效消息
+func (s *LocalCacheService) Close() error {
+	err := s.pubsub.Close()
+	<-s.done
+	s.cache.clear()
+	return err
+}
+
+// 获取统计信息
+func (s *LocalCacheService) Stats() LocalCacheStats {
+	entries, bytes, evictions := s.cache.stats()
+	return LocalCacheStats{
+		Hits:      atomic.LoadUint64(&s.hits),
+		Misses:    atomic.LoadUint64(&s.misses),
+		Evictions: evictions,
+		Entries:   entries,
+		Bytes:     bytes,
+	}
+}
+
+// 未命中时在一个pipeline中读取值及其剩余有效期
+func (s *LocalCacheService) StringGet(key string, opts ...RedisValueOption) IRedisValue {
+	normalizedKey := s.stringKey(key, opts...)
+	if v, ok := s.getLocal(normalizedKey); ok {
+		return v
+	}
+	gen := s.cache.keyGeneration(normalizedKey)
+	options := s.valueOptions(opts...)
+	remote := s.getRemote(options, normalizedKey)[0]
+	s.setLocal(options, normalizedKey, remote.value, remote.ttl, gen)
+	return remote.value
+}
+
+// 未命中的key按key读取值及其剩余有效期，Cluster模式下也不会产生CROSSSLOT错误
+func (s *LocalCacheService) StringMGet(opts []RedisValueOption, keys ...string) (map[string]IRedisValue, error) {
+	result := make(map[string]IRedisValue)
+	missingKeys := make([]string, 0)
+	for _, eachKey := range keys {
+		if v, ok := s.getLocal(s.stringKey(eachKey, opts...)); ok {
+			result[eachKey] = v
+			continue
+		}
+		missingKeys = append(missingKeys, eachKey)
+	}
+	if len(missingKeys) <= 0 {
+		return result, nil
+	}
+	options := s.valueOptions(opts...)
+	normalizedKeys := make([]string, 0, len(missingKeys))
+	gens := make([]uint64, 0, len(missingKeys))
+	for _, eachKey := range missingKeys {
+		normalizedKey := s.stringKey(eachKey, opts...)
+		normalizedKeys = append(normalizedKeys, normalizedKey)
+		gens = append(gens, s.cache.keyGeneration(normalizedKey))
+	}
+	for i, eachRemote := range s.getRemote(options, normalizedKeys...) {
+		if err := eachRemote.value.Err(); err != nil {
+			return nil, err
+		}
+		s.setLocal(options, normalizedKeys[i], eachRemote.value, eachRemote.ttl, gens[i])
+		result[missingKeys[i]] = eachRemote.value
+	}
+	return result, nil
+}
+
+// 先按StringGet读取，未命中时再调用IRedisService加载，有效期取自加载时写入redis的有效期
+func (s *LocalCacheService) StringGetOrLoad(key string, loader LoaderFunc, opts ...RedisValueOption) IRedisValue {
+	normalizedKey := s.stringKey(key, opts...)
+	if v, ok := s.getLocal(normalizedKey); ok {
+		return v
+	}
+	gen := s.cache.keyGeneration(normalizedKey)
+	options := s.valueOptions(opts...)
+	remote := s.getRemote(options, normalizedKey)[0]
+	hit := remote.value.Err() == nil && (remote.value.Exist() || remote.value.IsAbsent())
+	if hit && options.earlyRefreshBeta <= 0 {
+		s.setLocal(options, normalizedKey, remote.value, remote.ttl, gen)
+		return remote.value
+	}
+	v := s.IRedisService.StringGetOrLoad(key, loader, opts...)
+	ttl, known := valueTTL(v)
+	if !known && hit {
+		//启用了提前重建但本次没有重建，返回的是已经读取到的当前值
+		ttl, known = remote.ttl, true
+	}
+	//旧值副本以及由其它调用加载的值没有记录有效期，不缓存
+	if known {
+		s.setLocal(options, normalizedKey, v, ttl, gen)
+	}
+	return v
+}
+
+func (s *LocalCacheService) StringSet(key string, value interface{}, opts ...RedisValueOption) error {
+	err := s.IRedisService.StringSet(key, value, opts...)
+	return s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) StringMSet(values map[string]interface{}, opts ...RedisValueOption) error {
+	err := s.IRedisService.StringMSet(values, opts...)
+	if err != nil {
+		return err
+	}
+	for eachKey := range values {
+		if err := s.invalidate(nil, s.stringKey(eachKey, opts...), opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalCacheService) StringUpdate(key string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue {
+	v := s.IRedisService.StringUpdate(key, fn, opts...)
+	if err := s.invalidate(v.Err(), s.stringKey(key, opts...), opts...); err != nil {
+		return newErrRedisValue(err)
+	}
+	return v
+}
+
+func (s *LocalCacheService) HashUpdate(key string, field string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue {
+	v := s.IRedisService.HashUpdate(key, field, fn, opts...)
+	if err := s.invalidate(v.Err(), s.stringKey(key, opts...), opts...); err != nil {
+		return newErrRedisValue(err)
+	}
+	return v
+}
+
+func (s *LocalCacheService) KeyIncr(key string, opts ...RedisValueOption) (int64, error) {
+	v, err := s.IRedisService.KeyIncr(key, opts...)
+	return v, s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) KeyIncrBy(key string, value int64, opts ...RedisValueOption) (int64, error) {
+	v, err := s.IRedisService.KeyIncrBy(key, value, opts...)
+	return v, s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) KeyDecr(key string, opts ...RedisValueOption) (int64, error) {
+	v, err := s.IRedisService.KeyDecr(key, opts...)
+	return v, s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) KeyDecrBy(key string, decrement int64, opts ...RedisValueOption) (int64, error) {
+	v, err := s.IRedisService.KeyDecrBy(key, decrement, opts...)
+	return v, s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) DeleteKey(key string, opts ...RedisValueOption) error {
+	err := s.IRedisService.DeleteKey(key, opts...)
+	return s.invalidate(err, s.deleteKey(key, opts...), opts...)
+}
+
+// 按pattern删除时无法确定具体的key,所有实例都清空本地缓存
+func (s *LocalCacheService) DeleteKeys(pattern string, opts ...RedisValueOption) error {
+	err := s.IRedisService.DeleteKeys(pattern, opts...)
+	if err != nil {
+		return err
+	}
+	s.cache.clear()
+	return s.publish(invalidateAllMessage, opts...)
+}
+
+// tag对应的key在删除前无法确定,所有实例都清空本地缓存
+func (s *LocalCacheService) InvalidateTag(tag string, opts ...RedisValueOption) error {
+	err := s.IRedisService.InvalidateTag(tag, opts...)
+	if err != nil {
+		return err
+	}
+	s.cache.clear()
+	return s.publish(invalidateAllMessage, opts...)
+}
+
+func (s *LocalCacheService) HashSet(key string, values map[string]interface{}, opts ...RedisValueOption) error {
+	err := s.IRedisService.HashSet(key, values, opts...)
+	return s.invalidate(err, s.stringKey(key, opts...), opts...)
+}
+
+func (s *LocalCacheService) getLocal(normalizedKey string) (IRedisValue, bool) {
+	v, ok := s.cache.get(normalizedKey)
+	if ok {
+		atomic.AddUint64(&s.hits, 1)
+		return v, true
+	}
+	atomic.AddUint64(&s.misses, 1)
+	return nil, false
+}
+
+// 只缓存存在的值或者被缓存为不存在的值，有效期不超过ttl,ttl为0表示redis中没有过期时间
+// gen为从redis读取前key的generation,读取期间收到失效消息时不缓存
+func (s *LocalCacheService) setLocal(options *RedisValueOptions, normalizedKey string, v IRedisValue, ttl time.Duration, gen uint64) {
+	if v.Err() != nil || (!v.Exist() && !v.IsAbsent()) {
+		return
+	}
+	if v.IsAbsent() && options.negativeTTL > 0 && (ttl <= 0 || options.negativeTTL < ttl) {
+		ttl = options.negativeTTL
+	}
+	s.cache.set(normalizedKey, v, ttl, gen)
+}
+
+// 加载时写入redis的有效期
+func valueTTL(v IRedisValue) (time.Duration, bool) {
+	if expiring, ok := v.(interface {
+		knownTTL() (time.Duration, bool)
+	}); ok {
+		return expiring.knownTTL()
+	}
+	return 0, false
+}
+
+// 从redis读取的值及其剩余有效期
+type remoteValue struct {
+	value IRedisValue
+	//为0表示没有过期时间
+	ttl time.Duration
+}
+
+// 在一个pipeline中按key读取值及其剩余有效期
+// 已经过期或者即将过期的key返回不存在
+func (s *LocalCacheService) getRemote(options *RedisValueOptions, normalizedKeys ...string) []remoteValue {
+	getCmds := make([]*redis.StringCmd, 0, len(normalizedKeys))
+	ttlCmds := make([]*redis.DurationCmd, 0, len(normalizedKeys))
+	//每个命令的错误在下面单独处理
+	s.options.client.Pipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		for _, eachKey := range normalizedKeys {
+			getCmds = append(getCmds, pipe.Get(options.ctx, eachKey))
+			ttlCmds = append(ttlCmds, pipe.PTTL(options.ctx, eachKey))
+		}
+		return nil
+	})
+	result := make([]remoteValue, 0, len(normalizedKeys))
+	for i := range normalizedKeys {
+		b, err := getCmds[i].Bytes()
+		if err == redis.Nil {
+			result = append(result, remoteValue{value: newNilRedisValue()})
+			continue
+		}
+		if err != nil {
+			result = append(result, remoteValue{value: newErrRedisValue(err)})
+			continue
+		}
+		ttl, err := ttlCmds[i].Result()
+		if err != nil {
+			result = append(result, remoteValue{value: newErrRedisValue(err)})
+			continue
+		}
+		switch {
+		case ttl == -1:
+			//没有过期时间
+			ttl = 0
+		case ttl <= 0:
+			//GET之后已经过期
+			result = append(result, remoteValue{value: newNilRedisValue()})
+			continue
+		}
+		result = append(result, remoteValue{
+			value: newRedisValue(b, s.options.Unmarshal),
+			ttl:   ttl,
+		})
+	}
+	return result
+}
+
+// 写操作成功后删除本地缓存并通知其它实例
+func (s *LocalCacheService) invalidate(err error, normalizedKey string, opts ...RedisValueOption) error {
+	if err != nil {
+		return err
+	}
+	s.cache.remove(normalizedKey)
+	return s.publish(invalidateKeyMessagePrefix+normalizedKey, opts...)
+}
+
+func (s *LocalCacheService) publish(message string, opts ...RedisValueOption) error {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	return s.options.client.Publish(options.ctx, s.cacheOptions.InvalidationChannel, message).Err()
+}
+
+func (s *LocalCacheService) receiveInvalidations() {
+	defer close(s.done)
+	for msg := range s.pubsub.Channel() {
+		if msg.Payload == invalidateAllMessage {
+			s.cache.clear()
+			continue
+		}
+		if key := strings.TrimPrefix(msg.Payload, invalidateKeyMessagePrefix); key != msg.Payload {
+			s.cache.remove(key)
+		}
+	}
+}
+
+func (s *LocalCacheService) valueOptions(opts ...RedisValueOption) *RedisValueOptions {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+	return options
+}
+
+// string、hash操作使用的key
+func (s *LocalCacheService) stringKey(key string, opts ...RedisValueOption) string {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+	return options.appendKeyPrefix(key)
+}
+
+// DeleteKey使用的key,与RedisKeyService一致，支持WithoutPrefixKey
+func (s *LocalCacheService) deleteKey(key string, opts ...RedisValueOption) string {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+	if options.withoutPrefixKey {
+		return key
+	}
+	return options.appendKeyPrefix(key)
+}
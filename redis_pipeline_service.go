@@ -1,8 +1,69 @@
 package redis
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrPipelineNotExecuted = errors.New("redis: pipeline is not executed")
+)
+
 type IRedisPipelineService interface {
+	//创建一个pipeline,opts作为pipeline中所有操作的默认参数
+	Pipeline(opts ...RedisValueOption) IRedisPipeline
+	//批量设置值
+	PipelineSetData(list map[string]interface{}, opts ...RedisValueOption) error
+}
+
+// 在pipeline中排队的操作，每个操作返回的值在Exec之后才可以读取
+type IRedisPipeline interface {
+	StringGet(key string, opts ...RedisValueOption) IRedisValue
+	StringSet(key string, value interface{}, opts ...RedisValueOption) IRedisValue
+	KeyIncr(key string, opts ...RedisValueOption) IRedisValue
+	KeyIncrBy(key string, value int64, opts ...RedisValueOption) IRedisValue
+	KeyDecr(key string, opts ...RedisValueOption) IRedisValue
+	KeyDecrBy(key string, decrement int64, opts ...RedisValueOption) IRedisValue
+
+	HashGet(key string, field string, opts ...RedisValueOption) IRedisValue
+	HashGetAll(key string, opts ...RedisValueOption) *RedisValueMapResult
+	HashSet(key string, values map[string]interface{}, opts ...RedisValueOption) IRedisValue
+
+	ExistKey(key string, opts ...RedisValueOption) IRedisValue
+	DeleteKey(key string, opts ...RedisValueOption) IRedisValue
+	KeyExpire(key string, duration time.Duration, opts ...RedisValueOption) IRedisValue
+
+	//排队中的操作数
+	Len() int
+	//按batchSize分批执行所有排队的操作
+	//单个操作的错误只体现在该操作返回值的Err()中，不影响其它操作的执行
+	//有操作失败时返回*PipelineError
+	Exec() error
+}
+
+// 部分操作执行失败
+type PipelineError struct {
+	//失败的操作数
+	Failed int
+	//第一个失败操作的错误
+	First error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("redis: %d pipeline commands failed, first error: %v", e.Failed, e.First)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.First
 }
 
+var _ IRedisPipelineService = (*RedisPipelineService)(nil)
+
 // 默认的IRedisPipelineService实现
 type RedisPipelineService struct {
 	options *RedisOptions
@@ -14,6 +75,19 @@ func NewRedisPipelineService(options *RedisOptions) *RedisPipelineService {
 	}
 }
 
+// 创建一个pipeline
+func (s *RedisPipelineService) Pipeline(opts ...RedisValueOption) IRedisPipeline {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	return &redisPipeline{
+		options:     s.options,
+		defaultOpts: opts,
+		ctx:         options.ctx,
+		batchSize:   options.batchSize,
+	}
+}
+
 func (s *RedisPipelineService) PipelineSetData(list map[string]interface{}, opts ...RedisValueOption) error {
 	options := s.options.createRedisValueOptions()
 	options.applyOption(opts...)
@@ -25,9 +99,329 @@ func (s *RedisPipelineService) PipelineSetData(list map[string]interface{}, opts
 	}
 	pipe := s.options.client.Pipeline()
 	for key, v := range list {
-		pipe.Set(options.ctx, options.appendKeyPrefix(key), v, ttl)
+		data, err := options.marshal(v)
+		if err != nil {
+			return err
+		}
+		pipe.Set(options.ctx, options.appendKeyPrefix(key), data, ttl)
 	}
 
 	_, err := pipe.Exec(options.ctx)
 	return err
 }
+
+// pipeline中排队的一个操作
+type pipelineOp struct {
+	queue   func(pipe redis.Pipeliner) redis.Cmder
+	resolve func(cmd redis.Cmder)
+	//与主命令一起排队的附属命令，如维护tag集合，失败时整个操作视为失败
+	aux []redis.Cmder
+}
+
+// 操作的错误，主命令成功时取第一个失败的附属命令的错误
+func (op *pipelineOp) err(cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		return err
+	}
+	for _, eachCmd := range op.aux {
+		if err := eachCmd.Err(); err != nil && err != redis.Nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type redisPipeline struct {
+	options     *RedisOptions
+	defaultOpts []RedisValueOption
+	ctx         context.Context
+	batchSize   int
+
+	ops []*pipelineOp
+}
+
+// 合并pipeline的默认参数与操作本身的参数
+func (p *redisPipeline) createOptions(opts ...RedisValueOption) *RedisValueOptions {
+	options := p.options.createRedisValueOptions()
+	options.applyOption(p.defaultOpts...)
+	options.applyOption(opts...)
+	return options
+}
+
+func (p *redisPipeline) add(queue func(pipe redis.Pipeliner) redis.Cmder, resolve func(cmd redis.Cmder) IRedisValue) IRedisValue {
+	v := &pipelineValue{}
+	p.ops = append(p.ops, &pipelineOp{
+		queue: queue,
+		resolve: func(cmd redis.Cmder) {
+			v.resolve(resolve(cmd))
+		},
+	})
+	return v
+}
+
+// 与add相同，queue额外返回附属命令，附属命令失败时操作的结果为该错误
+func (p *redisPipeline) addWithAux(queue func(pipe redis.Pipeliner) (redis.Cmder, []redis.Cmder), resolve func(cmd redis.Cmder) IRedisValue) IRedisValue {
+	v := &pipelineValue{}
+	op := &pipelineOp{}
+	op.queue = func(pipe redis.Pipeliner) redis.Cmder {
+		cmd, aux := queue(pipe)
+		op.aux = aux
+		return cmd
+	}
+	op.resolve = func(cmd redis.Cmder) {
+		if err := op.err(cmd); err != nil && cmd.Err() == nil {
+			v.resolve(newErrRedisValue(err))
+			return
+		}
+		v.resolve(resolve(cmd))
+	}
+	p.ops = append(p.ops, op)
+	return v
+}
+
+// 根据命令的执行结果构建IRedisValue
+func resolveBytes(unmarshal UnmarshalFunc, cmd redis.Cmder, data func() ([]byte, error)) IRedisValue {
+	if err := cmd.Err(); err != nil {
+		if err == redis.Nil {
+			return newNilRedisValue()
+		}
+		return newErrRedisValue(err)
+	}
+	b, err := data()
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	return newRedisValue(b, unmarshal)
+}
+
+func resolveInt(cmd redis.Cmder) IRedisValue {
+	intCmd := cmd.(*redis.IntCmd)
+	return resolveBytes(_unmarshal, cmd, func() ([]byte, error) {
+		return []byte(strconv.FormatInt(intCmd.Val(), 10)), nil
+	})
+}
+
+func resolveBool(cmd redis.Cmder) IRedisValue {
+	boolCmd := cmd.(*redis.BoolCmd)
+	return resolveBytes(_unmarshal, cmd, func() ([]byte, error) {
+		return []byte(strconv.FormatBool(boolCmd.Val())), nil
+	})
+}
+
+func (p *redisPipeline) StringGet(key string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.Get(options.ctx, options.appendKeyPrefix(key))
+	}, func(cmd redis.Cmder) IRedisValue {
+		return resolveBytes(options.unmarshal, cmd, cmd.(*redis.StringCmd).Bytes)
+	})
+}
+
+func (p *redisPipeline) StringSet(key string, value interface{}, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	data, err := options.marshal(value)
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	normalizedKey := options.appendKeyPrefix(key)
+	ttl := options.getTTL()
+	return p.addWithAux(func(pipe redis.Pipeliner) (redis.Cmder, []redis.Cmder) {
+		cmd := pipe.Set(options.ctx, normalizedKey, data, ttl)
+		return cmd, options.addTags(pipe, normalizedKey, ttl)
+	}, func(cmd redis.Cmder) IRedisValue {
+		return resolveBytes(_unmarshal, cmd, func() ([]byte, error) {
+			return []byte(cmd.(*redis.StatusCmd).Val()), nil
+		})
+	})
+}
+
+func (p *redisPipeline) KeyIncr(key string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.Incr(options.ctx, options.appendKeyPrefix(key))
+	}, resolveInt)
+}
+
+func (p *redisPipeline) KeyIncrBy(key string, value int64, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.IncrBy(options.ctx, options.appendKeyPrefix(key), value)
+	}, resolveInt)
+}
+
+func (p *redisPipeline) KeyDecr(key string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.Decr(options.ctx, options.appendKeyPrefix(key))
+	}, resolveInt)
+}
+
+func (p *redisPipeline) KeyDecrBy(key string, decrement int64, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.DecrBy(options.ctx, options.appendKeyPrefix(key), decrement)
+	}, resolveInt)
+}
+
+func (p *redisPipeline) HashGet(key string, field string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.HGet(options.ctx, options.appendKeyPrefix(key), field)
+	}, func(cmd redis.Cmder) IRedisValue {
+		return resolveBytes(options.unmarshal, cmd, cmd.(*redis.StringCmd).Bytes)
+	})
+}
+
+func (p *redisPipeline) HashGetAll(key string, opts ...RedisValueOption) *RedisValueMapResult {
+	options := p.createOptions(opts...)
+	result := &RedisValueMapResult{err: ErrPipelineNotExecuted}
+	p.ops = append(p.ops, &pipelineOp{
+		queue: func(pipe redis.Pipeliner) redis.Cmder {
+			return pipe.HGetAll(options.ctx, options.appendKeyPrefix(key))
+		},
+		resolve: func(cmd redis.Cmder) {
+			result.resolve(cmd.(*redis.StringStringMapCmd), options.unmarshal)
+		},
+	})
+	return result
+}
+
+func (p *redisPipeline) HashSet(key string, values map[string]interface{}, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	data := make(map[string]interface{})
+	for eachKey, eachValue := range values {
+		currentSValue, err := options.marshal(eachValue)
+		if err != nil {
+			return newErrRedisValue(err)
+		}
+		data[eachKey] = string(currentSValue)
+	}
+	normalizedKey := options.appendKeyPrefix(key)
+	return p.addWithAux(func(pipe redis.Pipeliner) (redis.Cmder, []redis.Cmder) {
+		cmd := pipe.HSet(options.ctx, normalizedKey, data)
+		return cmd, options.addTags(pipe, normalizedKey, Redis_NoExpiration_TTL)
+	}, resolveInt)
+}
+
+func (p *redisPipeline) ExistKey(key string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.Exists(options.ctx, p.normalizeKey(key, options))
+	}, resolveInt)
+}
+
+func (p *redisPipeline) DeleteKey(key string, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	normalizedKey := p.normalizeKey(key, options)
+	return p.addWithAux(func(pipe redis.Pipeliner) (redis.Cmder, []redis.Cmder) {
+		cmd := pipe.Del(options.ctx, normalizedKey)
+		return cmd, options.removeTags(pipe, normalizedKey)
+	}, resolveInt)
+}
+
+func (p *redisPipeline) KeyExpire(key string, duration time.Duration, opts ...RedisValueOption) IRedisValue {
+	options := p.createOptions(opts...)
+	return p.add(func(pipe redis.Pipeliner) redis.Cmder {
+		return pipe.Expire(options.ctx, p.normalizeKey(key, options), duration)
+	}, resolveBool)
+}
+
+func (p *redisPipeline) Len() int {
+	return len(p.ops)
+}
+
+func (p *redisPipeline) Exec() error {
+	ops := p.ops
+	p.ops = nil
+
+	pipelineErr := &PipelineError{}
+	for start := 0; start < len(ops); start += p.batchSize {
+		end := start + p.batchSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+		batch := ops[start:end]
+		pipe := p.options.client.Pipeline()
+		cmds := make([]redis.Cmder, 0, len(batch))
+		for _, eachOp := range batch {
+			cmds = append(cmds, eachOp.queue(pipe))
+		}
+		//错误记录在每个命令中
+		pipe.Exec(p.ctx)
+		for i, eachOp := range batch {
+			eachOp.resolve(cmds[i])
+			if err := eachOp.err(cmds[i]); err != nil {
+				if pipelineErr.First == nil {
+					pipelineErr.First = err
+				}
+				pipelineErr.Failed++
+			}
+		}
+	}
+	if pipelineErr.Failed > 0 {
+		return pipelineErr
+	}
+	return nil
+}
+
+// key操作与RedisKeyService一致，支持WithoutPrefixKey
+func (p *redisPipeline) normalizeKey(key string, options *RedisValueOptions) string {
+	if options.withoutPrefixKey {
+		return key
+	}
+	return options.appendKeyPrefix(key)
+}
+
+// pipeline中的操作结果，在Exec之前返回ErrPipelineNotExecuted
+type pipelineValue struct {
+	value IRedisValue
+}
+
+var _ IRedisValue = (*pipelineValue)(nil)
+
+func (v *pipelineValue) resolve(value IRedisValue) {
+	v.value = value
+}
+
+func (v *pipelineValue) current() IRedisValue {
+	if v.value == nil {
+		return newErrRedisValue(ErrPipelineNotExecuted)
+	}
+	return v.value
+}
+
+func (v *pipelineValue) Exist() bool                   { return v.current().Exist() }
+func (v *pipelineValue) IsAbsent() bool                { return v.current().IsAbsent() }
+func (v *pipelineValue) Bytes() []byte                 { return v.current().Bytes() }
+func (v *pipelineValue) Err() error                    { return v.current().Err() }
+func (v *pipelineValue) ToValue(val interface{}) error { return v.current().ToValue(val) }
+func (v *pipelineValue) ValToString() string           { return v.current().ValToString() }
+func (v *pipelineValue) ValToInt() (int, error)        { return v.current().ValToInt() }
+func (v *pipelineValue) ValToInt32() (int32, error)    { return v.current().ValToInt32() }
+func (v *pipelineValue) ValToInt64() (int64, error)    { return v.current().ValToInt64() }
+func (v *pipelineValue) ValToBool() (bool, error)      { return v.current().ValToBool() }
+func (v *pipelineValue) ValToTime() (time.Time, error) { return v.current().ValToTime() }
+
+// pipeline中HashGetAll的结果，在Exec之前返回ErrPipelineNotExecuted
+type RedisValueMapResult struct {
+	value RedisValueMap
+	err   error
+}
+
+func (r *RedisValueMapResult) resolve(cmd *redis.StringStringMapCmd, unmarshal UnmarshalFunc) {
+	r.err = cmd.Err()
+	if r.err == redis.Nil {
+		r.err = nil
+	}
+	r.value = RedisValueMap{}
+	if r.err != nil {
+		return
+	}
+	for eachKey, eachValue := range cmd.Val() {
+		r.value[eachKey] = newRedisValue([]byte(eachValue), unmarshal)
+	}
+}
+
+func (r *RedisValueMapResult) Result() (RedisValueMap, error) {
+	return r.value, r.err
+}
@@ -0,0 +1,116 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	//tag集合的key前缀
+	tagKeyPrefix = "tag::"
+	//将key加入tag集合，并确保集合的有效期不短于key的有效期
+	//ARGV[2]为key的有效期(毫秒)，小于0表示key不过期
+	tagAddCommand = `local existed = redis.call("EXISTS", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl < 0 then
+	redis.call("PERSIST", KEYS[1])
+	return 1
+end
+local current = redis.call("PTTL", KEYS[1])
+if existed == 0 or (current >= 0 and current < ttl) then
+	redis.call("PEXPIRE", KEYS[1], ttl)
+end
+return 1`
+)
+
+// 写入值时为key打上tag,之后可以通过InvalidateTag删除带有该tag的所有key
+// 用于DeleteKey时会把key从这些tag集合中移除
+func WithTags(tags ...string) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.tags = append(rvo.tags, tags...)
+	}
+}
+
+// tag集合在redis中的key
+func (o *RedisValueOptions) tagKey(tag string) string {
+	return o.appendKeyPrefix(tagKeyPrefix + tag)
+}
+
+// 在pipeline中将key加入options中指定的所有tag集合
+// ttl为key的有效期，tag集合的有效期会延长到不短于该有效期
+// 返回排队的命令，调用方可以据此检查打tag是否成功
+func (o *RedisValueOptions) addTags(pipe redis.Pipeliner, normalizedKey string, ttl time.Duration) []redis.Cmder {
+	ttlMillis := int64(-1)
+	if ttl > 0 {
+		ttlMillis = ttl.Milliseconds()
+	}
+	cmds := make([]redis.Cmder, 0, len(o.tags))
+	for _, eachTag := range o.tags {
+		cmds = append(cmds, pipe.Eval(o.ctx, tagAddCommand, []string{o.tagKey(eachTag)}, normalizedKey, strconv.FormatInt(ttlMillis, 10)))
+	}
+	return cmds
+}
+
+// 在pipeline中将key从options中指定的所有tag集合移除
+func (o *RedisValueOptions) removeTags(pipe redis.Pipeliner, normalizedKey string) []redis.Cmder {
+	cmds := make([]redis.Cmder, 0, len(o.tags))
+	for _, eachTag := range o.tags {
+		cmds = append(cmds, pipe.SRem(o.ctx, o.tagKey(eachTag), normalizedKey))
+	}
+	return cmds
+}
+
+// 将key加入options中指定的所有tag集合
+// 用于无法与写入操作放在同一个事务中的场景，如WATCH的事务只能包含同一个slot的key
+func (s *RedisKeyService) addTags(options *RedisValueOptions, normalizedKey string, ttl time.Duration) error {
+	if len(options.tags) <= 0 {
+		return nil
+	}
+	_, err := s.options.client.Pipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		options.addTags(pipe, normalizedKey, ttl)
+		return nil
+	})
+	return err
+}
+
+// 删除带有指定tag的所有key
+// 集合中已经过期的key删除时会被忽略，只会从集合中移除本次读到的成员，
+// 因此与并发的打tag操作不会互相覆盖
+func (s *RedisKeyService) InvalidateTag(tag string, opts ...RedisValueOption) error {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	tagKey := options.tagKey(tag)
+	var cursor uint64
+	for {
+		members, nextCursor, err := s.options.client.SScan(options.ctx, tagKey, cursor, "", options.scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if err := s.invalidateMembers(options.ctx, tagKey, members); err != nil {
+			return err
+		}
+		cursor = nextCursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (s *RedisKeyService) invalidateMembers(ctx context.Context, tagKey string, members []string) error {
+	if len(members) <= 0 {
+		return nil
+	}
+	if err := s.deleteBatch(ctx, members); err != nil {
+		return err
+	}
+	values := make([]interface{}, 0, len(members))
+	for _, eachMember := range members {
+		values = append(values, eachMember)
+	}
+	return s.options.client.SRem(ctx, tagKey, values...).Err()
+}
@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"errors"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrTxRetriesExceeded = errors.New("redis: transaction retries exceeded")
+)
+
+const (
+	//乐观事务默认的最大重试次数
+	defaultTxMaxRetries = 10
+	//乐观事务重试的默认最小等待时间
+	defaultTxMinBackoff = 5 * time.Millisecond
+	//乐观事务重试的默认最大等待时间
+	defaultTxMaxBackoff = 500 * time.Millisecond
+)
+
+// 根据当前值计算新值，返回nil表示删除
+// 返回错误时放弃本次更新
+type UpdateFunc func(current IRedisValue) (interface{}, error)
+
+// WATCH指定的key并执行fn,事务因为key被修改而失败时按退避策略重试
+func (o *RedisOptions) watch(options *RedisValueOptions, fn func(tx *redis.Tx) error, keys ...string) error {
+	for attempt := 0; ; attempt++ {
+		err := o.client.Watch(options.ctx, fn, keys...)
+		if err != redis.TxFailedErr {
+			return err
+		}
+		if attempt >= options.maxRetries {
+			return ErrTxRetriesExceeded
+		}
+		if err := sleepContext(options.ctx, retryBackoff(attempt, options.minBackoff, options.maxBackoff)); err != nil {
+			return err
+		}
+	}
+}
+
+// 读取值的命令结果转换为IRedisValue
+func toRedisValue(b []byte, err error, unmarshal UnmarshalFunc) IRedisValue {
+	if err != nil {
+		if err == redis.Nil {
+			return newNilRedisValue()
+		}
+		return newErrRedisValue(err)
+	}
+	return newRedisValue(b, unmarshal)
+}
+
+// 乐观事务的最大重试次数
+func WithMaxRetries(maxRetries int) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.maxRetries = maxRetries
+	}
+}
+
+// 重试的等待时间，从min开始按指数增长，最大为max,并带有随机抖动
+func WithRetryBackoff(min, max time.Duration) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.minBackoff = min
+		rvo.maxBackoff = max
+	}
+}
@@ -1,12 +1,20 @@
 package redis
 
-import "github.com/go-redis/redis/v8"
+import (
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
 
 type IRedisHashService interface {
 	HashGet(key string, field string, opts ...RedisValueOption) IRedisValue
 	HashGetAll(key string, opts ...RedisValueOption) (RedisValueMap, error)
 
 	HashSet(key string, values map[string]interface{}, opts ...RedisValueOption) error
+	//对hash中的field执行读取-修改-写入,key在此期间被修改时自动重试
+	HashUpdate(key string, field string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue
+	//获取hash中的field,如果不存在则调用loader加载并写入redis
+	HashGetOrLoad(key string, field string, loader LoaderFunc, opts ...RedisValueOption) IRedisValue
 }
 
 type RedisHashService struct {
@@ -62,7 +70,7 @@ func (s *RedisHashService) HashGetAll(key string, opts ...RedisValueOption) (Red
 
 func (s *RedisHashService) HashSet(key string, values map[string]interface{}, opts ...RedisValueOption) error {
 	options := s.options.createRedisValueOptions()
-	options.applyOption()
+	options.applyOption(opts...)
 
 	data := make(map[string]interface{})
 	for eachKey, eachValue := range values {
@@ -72,5 +80,95 @@ func (s *RedisHashService) HashSet(key string, values map[string]interface{}, op
 		}
 		data[eachKey] = string(currentSValue)
 	}
-	return s.options.client.HSet(options.ctx, options.appendKeyPrefix(key), data).Err()
+	normalizedKey := options.appendKeyPrefix(key)
+	if len(options.tags) <= 0 {
+		return s.options.client.HSet(options.ctx, normalizedKey, data).Err()
+	}
+	//HashSet不设置有效期，tag集合也不过期
+	_, err := s.options.client.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(options.ctx, normalizedKey, data)
+		options.addTags(pipe, normalizedKey, Redis_NoExpiration_TTL)
+		return nil
+	})
+	return err
+}
+
+// 获取hash中的field,如果不存在则调用loader加载并写入redis
+// 指定了ttl时会同时设置整个hash的过期时间
+func (s *RedisHashService) HashGetOrLoad(key string, field string, loader LoaderFunc, opts ...RedisValueOption) IRedisValue {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	normalizedKey := options.appendKeyPrefix(key)
+	c := &cacheAside{
+		client:    s.options.client,
+		options:   options,
+		key:       normalizedKey,
+		flightKey: hashFlightKey(normalizedKey, field),
+		auxKey:    normalizedKey + "::" + field,
+		get: func() IRedisValue {
+			return s.HashGet(key, field, opts...)
+		},
+		set: func(pipe redis.Pipeliner, data []byte, ttl time.Duration) {
+			pipe.HSet(options.ctx, normalizedKey, field, string(data))
+			if ttl > 0 {
+				pipe.Expire(options.ctx, normalizedKey, ttl)
+			}
+		},
+		separateTombstone: true,
+		ttl: func() *time.Duration {
+			return s.KeyTimeToLive(key, opts...)
+		},
+	}
+	return c.getOrLoad(s.options.loadGroup, loader)
+}
+
+// 使用WATCH/MULTI/EXEC对hash中的field执行读取-修改-写入
+// fn返回nil时删除该field,否则写入新值，并在指定了WithTTL时刷新整个hash的有效期
+func (s *RedisHashService) HashUpdate(key string, field string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	normalizedKey := options.appendKeyPrefix(key)
+	ttl := options.getTTL()
+	var result IRedisValue
+	err := s.options.watch(options, func(tx *redis.Tx) error {
+		b, err := tx.HGet(options.ctx, normalizedKey, field).Bytes()
+		current := toRedisValue(b, err, options.unmarshal)
+		if err := current.Err(); err != nil {
+			return err
+		}
+		value, err := fn(current)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			result = newNilRedisValue()
+			_, err = tx.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+				pipe.HDel(options.ctx, normalizedKey, field)
+				return nil
+			})
+			return err
+		}
+		data, err := options.marshal(value)
+		if err != nil {
+			return err
+		}
+		result = newRedisValue(data, options.unmarshal)
+		_, err = tx.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(options.ctx, normalizedKey, field, string(data))
+			if ttl > 0 {
+				pipe.Expire(options.ctx, normalizedKey, ttl)
+			}
+			return nil
+		})
+		return err
+	}, normalizedKey)
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	if err := s.addTags(options, normalizedKey, ttl); err != nil {
+		return newErrRedisValue(err)
+	}
+	return result
 }
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"time"
 
 	redis "github.com/go-redis/redis/v8"
@@ -8,10 +9,12 @@ import (
 
 // 对redis中的key进行操作的接口
 type IRedisKeyService interface {
-	GetRedisClient() *redis.Client
+	GetRedisClient() redis.UniversalClient
 
 	//搜索符合pattern的key列表
 	Keys(keyPattern string, opts ...RedisValueOption) ([]string, error)
+	//以迭代器的方式搜索符合pattern的key,适用于key数量很大的场景
+	ScanKeys(keyPattern string, opts ...RedisValueOption) *KeyIterator
 	ExistKey(key string, opts ...RedisValueOption) (bool, error)
 	DeleteKey(key string, opts ...RedisValueOption) error
 	//删除指定前缀的所有key
@@ -20,6 +23,8 @@ type IRedisKeyService interface {
 	KeyExpire(key string, duration time.Duration, opts ...RedisValueOption) error
 	//获取key的过期时间
 	KeyTimeToLive(key string, opts ...RedisValueOption) *time.Duration
+	//删除通过WithTags打上了指定tag的所有key
+	InvalidateTag(tag string, opts ...RedisValueOption) error
 }
 
 var _ IRedisKeyService = (*RedisKeyService)(nil)
@@ -35,20 +40,37 @@ func NewRedisKeyService(options *RedisOptions) *RedisKeyService {
 	}
 }
 
-func (s *RedisKeyService) GetRedisClient() *redis.Client {
+func (s *RedisKeyService) GetRedisClient() redis.UniversalClient {
 	return s.options.client
 }
 
 // 搜索符合pattern的key列表
+// 使用SCAN实现,不会阻塞redis
 func (s *RedisKeyService) Keys(keyPattern string, opts ...RedisValueOption) ([]string, error) {
+	it := s.ScanKeys(keyPattern, opts...)
+	keys := make([]string, 0)
+	seen := make(map[string]struct{})
+	for it.Next() {
+		//SCAN可能返回重复的key
+		key := it.Key()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	if err := it.Err(); err != nil {
+		return make([]string, 0), err
+	}
+	return keys, nil
+}
+
+// 以迭代器的方式搜索符合pattern的key
+func (s *RedisKeyService) ScanKeys(keyPattern string, opts ...RedisValueOption) *KeyIterator {
 	options := s.options.createRedisValueOptions()
 	options.applyOption(opts...)
 
-	v := s.options.client.Keys(options.ctx, keyPattern)
-	if v.Err() != nil {
-		return make([]string, 0), v.Err()
-	}
-	return v.Val(), nil
+	return newKeyIterator(options.ctx, s.options.client, s.appendKeyPrefix(keyPattern, options), options)
 }
 
 func (s *RedisKeyService) ExistKey(key string, opts ...RedisValueOption) (bool, error) {
@@ -62,29 +84,63 @@ func (s *RedisKeyService) ExistKey(key string, opts ...RedisValueOption) (bool,
 	return v.Val() > 0, nil
 }
 
+// 删除key,通过WithTags指定key写入时的tag,同时将key从这些tag集合中移除
 func (s *RedisKeyService) DeleteKey(key string, opts ...RedisValueOption) error {
 	options := s.options.createRedisValueOptions()
 	options.applyOption(opts...)
 
-	return s.options.client.Del(options.ctx, s.appendKeyPrefix(key, options)).Err()
+	normalizedKey := s.appendKeyPrefix(key, options)
+	if len(options.tags) <= 0 {
+		return s.options.client.Del(options.ctx, normalizedKey).Err()
+	}
+	//key与tag集合可能不在同一个slot,不使用事务
+	_, err := s.options.client.Pipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(options.ctx, normalizedKey)
+		options.removeTags(pipe, normalizedKey)
+		return nil
+	})
+	return err
 }
 
 // 删除指定前缀的所有key
+// 使用SCAN遍历,并按batchSize分批通过pipeline删除
 func (s *RedisKeyService) DeleteKeys(pattern string, opts ...RedisValueOption) error {
 	if len(pattern) <= 0 {
 		return nil
 	}
-	delWithPrefix := `
-	local keys = redis.call('keys', ARGV[1]) 
-                for i=1,#keys,5000 do 
-                redis.call('del', unpack(keys, i, math.min(i+4999, #keys)))
-                end
-	`
 	options := s.options.createRedisValueOptions()
 	options.applyOption(opts...)
 
-	cmd := s.options.client.Eval(options.ctx, delWithPrefix, []string{s.appendKeyPrefix(pattern, options)})
-	return cmd.Err()
+	it := newKeyIterator(options.ctx, s.options.client, s.appendKeyPrefix(pattern, options), options)
+	batch := make([]string, 0, options.batchSize)
+	for it.Next() {
+		batch = append(batch, it.Key())
+		if len(batch) < options.batchSize {
+			continue
+		}
+		if err := s.deleteBatch(options.ctx, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return s.deleteBatch(options.ctx, batch)
+}
+
+// 一次删除一批key,每个key单独DEL,以避免Cluster模式下的CROSSSLOT错误
+func (s *RedisKeyService) deleteBatch(ctx context.Context, keys []string) error {
+	if len(keys) <= 0 {
+		return nil
+	}
+	_, err := s.options.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, eachKey := range keys {
+			pipe.Del(ctx, eachKey)
+		}
+		return nil
+	})
+	return err
 }
 
 // 设置key的过期时间
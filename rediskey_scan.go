@@ -0,0 +1,147 @@
+package redis
+
+import (
+	"context"
+	"sync"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	//SCAN时每次迭代的默认COUNT
+	defaultScanCount int64 = 1000
+	//批量删除时每批的默认key数量
+	defaultScanBatchSize int = 500
+)
+
+// 基于SCAN的key迭代器
+// Cluster/Ring模式下会依次遍历每个master节点
+//
+//	it := s.ScanKeys("user:*")
+//	for it.Next() {
+//		key := it.Key()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type KeyIterator struct {
+	ctx     context.Context
+	nodes   []redis.UniversalClient
+	pattern string
+	count   int64
+	keyType string
+
+	nodeIndex int
+	cursor    uint64
+	started   bool
+	page      []string
+	pos       int
+	current   string
+	err       error
+}
+
+func newKeyIterator(ctx context.Context, client redis.UniversalClient, pattern string, options *RedisValueOptions) *KeyIterator {
+	it := &KeyIterator{
+		ctx:     ctx,
+		pattern: pattern,
+		count:   options.scanCount,
+		keyType: options.keyType,
+	}
+	it.nodes, it.err = masterNodes(ctx, client)
+	return it
+}
+
+// 移动到下一个key,没有更多的key或者出错时返回false
+func (it *KeyIterator) Next() bool {
+	for it.err == nil {
+		if it.pos < len(it.page) {
+			it.current = it.page[it.pos]
+			it.pos++
+			return true
+		}
+		if it.nodeIndex >= len(it.nodes) {
+			return false
+		}
+		if it.started && it.cursor == 0 {
+			//当前节点已经遍历完成
+			it.nodeIndex++
+			it.started = false
+			continue
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		it.fetch()
+	}
+	return false
+}
+
+// 当前的key
+func (it *KeyIterator) Key() string {
+	return it.current
+}
+
+// 迭代过程中发生的错误
+func (it *KeyIterator) Err() error {
+	return it.err
+}
+
+func (it *KeyIterator) fetch() {
+	node := it.nodes[it.nodeIndex]
+	var cmd *redis.ScanCmd
+	if len(it.keyType) > 0 {
+		cmd = node.ScanType(it.ctx, it.cursor, it.pattern, it.count, it.keyType)
+	} else {
+		cmd = node.Scan(it.ctx, it.cursor, it.pattern, it.count)
+	}
+	page, cursor, err := cmd.Result()
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.started = true
+	it.cursor = cursor
+	it.page = page
+	it.pos = 0
+}
+
+// 获取需要执行SCAN的所有master节点
+func masterNodes(ctx context.Context, client redis.UniversalClient) ([]redis.UniversalClient, error) {
+	var mu sync.Mutex
+	nodes := make([]redis.UniversalClient, 0)
+	err := forEachMaster(ctx, client, func(ctx context.Context, node redis.UniversalClient) error {
+		mu.Lock()
+		defer mu.Unlock()
+		nodes = append(nodes, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// 指定SCAN时每次迭代的COUNT
+func WithScanCount(count int64) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		if count > 0 {
+			rvo.scanCount = count
+		}
+	}
+}
+
+// 指定批量操作时每批的key数量
+func WithBatchSize(batchSize int) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		if batchSize > 0 {
+			rvo.batchSize = batchSize
+		}
+	}
+}
+
+// SCAN时只返回指定类型的key,如string、hash、list、set、zset、stream
+func WithKeyType(keyType string) RedisValueOption {
+	return func(rvo *RedisValueOptions) {
+		rvo.keyType = keyType
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -19,6 +21,15 @@ const (
 else
     return redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2])
 end`
+	//加锁成功时递增fencing计数并返回新值，已经持有锁时刷新有效期并返回当前值
+	lockFencingCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+    redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+    return tonumber(redis.call("GET", KEYS[2]) or "0")
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+    return redis.call("INCR", KEYS[2])
+end
+return false`
 	delCommand = `local val = redis.call("GET", KEYS[1])
 if val then
 	if val == ARGV[1] then
@@ -33,26 +44,158 @@ end`
 
 // A RedisLock is a redis lock.
 type RedisLock struct {
-	Store   *redis.Client
+	Store   redis.Cmdable
 	Seconds uint32
 	Key     string
 	Value   string
+
+	//Lock和TryLockFor重试的等待时间范围及抖动比例
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+
+	//是否启用fencing token,以及最近一次加锁得到的token
+	fencing      bool
+	fencingToken int64
+	//是否为可重入锁
+	reentrant bool
+
+	//启用watchdog时续期的间隔，为0时不启用
+	watchdogInterval time.Duration
+	watchdogMu       sync.Mutex
+	watchdog         *lockWatchdog
+}
+
+type LockOption func(rl *RedisLock)
+
+// 指定Lock和TryLockFor重试的等待时间，从min开始按指数增长，最大为max,默认为10ms~500ms
+func WithLockBackoff(min, max time.Duration) LockOption {
+	return func(rl *RedisLock) {
+		if min > 0 && max >= min {
+			rl.minBackoff = min
+			rl.maxBackoff = max
+		}
+	}
+}
+
+// 指定重试等待时间中随机抖动的比例，取值[0, 1],默认为1,即在[0, 等待时间]范围内随机
+func WithLockJitter(jitter float64) LockOption {
+	return func(rl *RedisLock) {
+		rl.jitter = jitter
+	}
+}
+
+// 自动生成密码学安全的随机值作为锁的持有者标识，忽略NewRedisLock传入的value
+func WithRandomValue() LockOption {
+	return func(rl *RedisLock) {
+		rl.Value = randomToken(RedisRandLen)
+	}
+}
+
+// 启用fencing token,每次加锁成功时在同一个脚本中递增计数器，通过FencingToken获取
+// 下游存储可以拒绝token小于已知最大值的写入，避免锁过期后旧的持有者继续写入
+func WithFencing() LockOption {
+	return func(rl *RedisLock) {
+		rl.fencing = true
+	}
 }
 
 // NewRedisLock returns a RedisLock.
-func NewRedisLock(store *redis.Client, key string, value string, expire uint32) *RedisLock {
-	return &RedisLock{
-		Store:   store,
-		Key:     key,
-		Value:   value,
-		Seconds: expire,
+func NewRedisLock(store redis.Cmdable, key string, value string, expire uint32, opts ...LockOption) *RedisLock {
+	rl := &RedisLock{
+		Store:      store,
+		Key:        key,
+		Value:      value,
+		Seconds:    expire,
+		minBackoff: 10 * time.Millisecond,
+		maxBackoff: 500 * time.Millisecond,
+		jitter:     1,
+	}
+	for _, eachOpt := range opts {
+		eachOpt(rl)
 	}
+	return rl
 }
 
 // RedisAcquire Lua script方式加锁
 func (rl *RedisLock) RedisAcquire() (bool, error) {
+	return rl.acquire(context.Background())
+}
+
+// 尝试加锁一次，锁已经被其它持有者持有时返回false
+func (rl *RedisLock) TryLock(ctx context.Context) (bool, error) {
+	ok, err := rl.acquire(ctx)
+	if err == redis.Nil {
+		return false, nil
+	}
+	return ok, err
+}
+
+// 加锁，锁已经被持有时按退避策略重试，直到获取到锁或者ctx被取消
+func (rl *RedisLock) Lock(ctx context.Context) error {
+	return rl.retry(ctx, rl.TryLock)
+}
+
+// 加锁，最多等待wait,超时后返回false,wait<=0时与TryLock相同
+func (rl *RedisLock) TryLockFor(ctx context.Context, wait time.Duration) (bool, error) {
+	return rl.retryFor(ctx, wait, rl.TryLock)
+}
+
+// 按退避策略重复执行try,直到返回true、出错或者ctx被取消
+func (rl *RedisLock) retry(ctx context.Context, try func(ctx context.Context) (bool, error)) error {
+	for attempt := 0; ; attempt++ {
+		ok, err := try(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if err := sleepContext(ctx, jitterBackoff(attempt, rl.minBackoff, rl.maxBackoff, rl.jitter)); err != nil {
+			return err
+		}
+	}
+}
+
+// 与retry相同，但最多等待wait,超时后返回false
+// 无论wait多短都至少使用调用方的ctx尝试一次
+func (rl *RedisLock) retryFor(ctx context.Context, wait time.Duration, try func(ctx context.Context) (bool, error)) (bool, error) {
+	ok, err := try(ctx)
+	if ok || err != nil || wait <= 0 {
+		return ok, err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	err = rl.retry(waitCtx, try)
+	if err == nil {
+		return true, nil
+	}
+	//调用方的ctx没有被取消，说明是等待超时
+	if waitCtx.Err() != nil && ctx.Err() == nil {
+		return false, nil
+	}
+	return false, err
+}
+
+// 加锁成功后启用watchdog时开始自动续期
+func (rl *RedisLock) acquire(ctx context.Context) (bool, error) {
+	ok, err := rl.eval(ctx)
+	if ok {
+		rl.startWatchdog()
+	}
+	return ok, err
+}
+
+// 执行加锁脚本，已经持有锁时刷新有效期
+func (rl *RedisLock) eval(ctx context.Context) (bool, error) {
 	seconds := atomic.LoadUint32(&rl.Seconds)
-	resp, err := rl.Store.Eval(context.Background(), lockCommand, []string{rl.Key}, []string{
+	if rl.reentrant {
+		return rl.evalReentrant(ctx, seconds)
+	}
+	if rl.fencing {
+		return rl.evalFencing(ctx, seconds)
+	}
+	resp, err := rl.Store.Eval(ctx, lockCommand, []string{rl.Key}, []string{
 		rl.Value, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
 	}).Result()
 	if err == redis.Nil {
@@ -71,14 +214,36 @@ func (rl *RedisLock) RedisAcquire() (bool, error) {
 	return false, nil
 }
 
+func (rl *RedisLock) evalFencing(ctx context.Context, seconds uint32) (bool, error) {
+	token, err := rl.Store.Eval(ctx, lockFencingCommand, []string{rl.Key, rl.fencingKey()}, []string{
+		rl.Value, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
+	}).Int64()
+	if err != nil {
+		return false, err
+	}
+	atomic.StoreInt64(&rl.fencingToken, token)
+	return true, nil
+}
+
+// 最近一次加锁成功时得到的fencing token,单调递增，未启用WithFencing或者尚未加锁时为0
+func (rl *RedisLock) FencingToken() int64 {
+	return atomic.LoadInt64(&rl.fencingToken)
+}
+
+// fencing计数器的key,与锁的key位于同一个slot
+func (rl *RedisLock) fencingKey() string {
+	return hashTagged(rl.Key) + "::fencing"
+}
+
 // RedisRelease releases the lock.
 // @ return
 // @   int64: Released number
 // @	 0 - exist key but given a wrong token
 // @	 -1 - key is not exist
 // @	 -2 - other errors
-func (rl *RedisLock) RedisRelease() (int64, error) {
-	v, err := rl.Store.Eval(context.Background(), delCommand, []string{rl.Key}, []string{rl.Value}).Int64()
+func (rl *RedisLock) RedisRelease(ctx context.Context) (int64, error) {
+	rl.stopWatchdog()
+	v, err := rl.Store.Eval(ctx, delCommand, []string{rl.Key}, []string{rl.Value}).Int64()
 	if err != nil {
 		return -2, err
 	}
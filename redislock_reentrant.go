@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	//锁不存在或者已经被同一个持有者持有时增加持有次数，返回新的持有次数
+	reentrantLockCommand = `if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	local count = redis.call("HINCRBY", KEYS[1], ARGV[1], 1)
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return count
+end
+return false`
+	//减少持有次数，减为0时删除锁，返回剩余的持有次数，不是持有者时返回-1
+	reentrantUnlockCommand = `if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return -1
+end
+local count = redis.call("HINCRBY", KEYS[1], ARGV[1], -1)
+if count <= 0 then
+	redis.call("DEL", KEYS[1])
+	return 0
+end
+return count`
+	//仍然是持有者时刷新有效期
+	reentrantRefreshCommand = `if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`
+)
+
+// 可重入锁，同一个持有者可以多次加锁，持有次数记录在hash中，
+// 每次RedisRelease减少一次，减为0时才真正释放
+// 不支持WithFencing
+type ReentrantLock struct {
+	*RedisLock
+}
+
+// 创建可重入锁，同一个value视为同一个持有者
+func NewReentrantLock(store redis.Cmdable, key string, value string, expire uint32, opts ...LockOption) *ReentrantLock {
+	rl := NewRedisLock(store, key, value, expire, opts...)
+	rl.reentrant = true
+	rl.fencing = false
+	return &ReentrantLock{RedisLock: rl}
+}
+
+// RedisRelease减少一次持有次数，减为0时释放锁
+// @ return
+// @   int64: 剩余的持有次数
+// @	 0 - 锁已经释放
+// @	 -1 - 不是锁的持有者或者锁已经过期
+// @	 -2 - other errors
+func (rl *ReentrantLock) RedisRelease(ctx context.Context) (int64, error) {
+	remaining, err := rl.Store.Eval(ctx, reentrantUnlockCommand, []string{rl.Key}, []string{rl.Value}).Int64()
+	if err != nil {
+		return -2, err
+	}
+	if remaining <= 0 {
+		rl.stopWatchdog()
+	}
+	return remaining, nil
+}
+
+// 当前持有者的持有次数
+func (rl *ReentrantLock) HoldCount(ctx context.Context) (int64, error) {
+	count, err := rl.Store.HGet(ctx, rl.Key, rl.Value).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (rl *RedisLock) evalReentrant(ctx context.Context, seconds uint32) (bool, error) {
+	err := rl.Store.Eval(ctx, reentrantLockCommand, []string{rl.Key}, []string{
+		rl.Value, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
+	}).Err()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
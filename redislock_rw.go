@@ -0,0 +1,171 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	//删除已经过期的读锁，读锁记录在hash中，值为过期时间(毫秒)
+	rwPurgeReaders = `redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local readers = redis.call("HGETALL", KEYS[2])
+for i = 1, #readers, 2 do
+	if tonumber(readers[i + 1]) <= now then
+		redis.call("HDEL", KEYS[2], readers[i])
+	end
+end
+`
+	//没有写锁、也没有等待中的写者时加读锁，已经持有读锁时刷新有效期
+	//KEYS[1]为写锁，KEYS[2]为读锁hash,KEYS[3]为等待中的写者
+	rwReadLockCommand = rwPurgeReaders + `if redis.call("HEXISTS", KEYS[2], ARGV[1]) == 0 then
+	if redis.call("EXISTS", KEYS[1]) == 1 or redis.call("EXISTS", KEYS[3]) == 1 then
+		return 0
+	end
+end
+redis.call("HSET", KEYS[2], ARGV[1], now + tonumber(ARGV[2]))
+if redis.call("PTTL", KEYS[2]) < tonumber(ARGV[2]) then
+	redis.call("PEXPIRE", KEYS[2], ARGV[2])
+end
+return 1`
+	//没有读锁、写锁，并且没有其它先到的写者等待时加写锁，已经持有写锁时刷新有效期
+	//无法加锁时登记为等待中的写者，之后的读者不能再加读锁，避免写者饥饿
+	rwWriteLockCommand = rwPurgeReaders + `local writer = redis.call("GET", KEYS[1])
+if writer == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+local waiting = redis.call("GET", KEYS[3])
+if writer or redis.call("HLEN", KEYS[2]) > 0 or (waiting and waiting ~= ARGV[1]) then
+	if not waiting or waiting == ARGV[1] then
+		redis.call("SET", KEYS[3], ARGV[1], "PX", ARGV[2])
+	end
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+if waiting then
+	redis.call("DEL", KEYS[3])
+end
+return 1`
+	//释放读锁
+	rwReadUnlockCommand = `return redis.call("HDEL", KEYS[1], ARGV[1])`
+	//释放写锁，也用于放弃等待时取消等待中的写者登记
+	rwWriteUnlockCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`
+)
+
+// 分布式读写锁，允许多个读者或者一个写者同时持有
+// 写者优先：有写者等待时新的读者不能加锁，等待中的写者在已有读者释放或者过期后加锁
+// 每个读者、写者都有各自的有效期，并且只能释放自己持有的锁
+// 同一个RWLock实例代表一个持有者，并发的持有者应各自创建RWLock,例如通过WithRandomValue
+type RWLock struct {
+	//锁的key、持有者标识、有效期以及重试参数
+	lock *RedisLock
+}
+
+// 创建读写锁，opts中的WithRandomValue、WithLockBackoff、WithLockJitter生效
+func NewRWLock(store redis.Cmdable, key string, value string, expire uint32, opts ...LockOption) *RWLock {
+	return &RWLock{
+		lock: NewRedisLock(store, key, value, expire, opts...),
+	}
+}
+
+// 持有者标识
+func (l *RWLock) Value() string {
+	return l.lock.Value
+}
+
+// 尝试加读锁一次
+func (l *RWLock) TryRLock(ctx context.Context) (bool, error) {
+	return l.eval(ctx, rwReadLockCommand)
+}
+
+// 加读锁，直到获取到锁或者ctx被取消
+func (l *RWLock) RLock(ctx context.Context) error {
+	return l.lock.retry(ctx, l.TryRLock)
+}
+
+// 加读锁，最多等待wait,超时后返回false
+func (l *RWLock) TryRLockFor(ctx context.Context, wait time.Duration) (bool, error) {
+	return l.lock.retryFor(ctx, wait, l.TryRLock)
+}
+
+// 释放读锁，返回是否持有读锁
+func (l *RWLock) RUnlock(ctx context.Context) (bool, error) {
+	released, err := l.lock.Store.Eval(ctx, rwReadUnlockCommand, []string{l.readersKey()}, l.lock.Value).Int64()
+	return released > 0, err
+}
+
+// 尝试加写锁一次，失败时不保留等待中的写者登记，不会阻塞之后的读者
+func (l *RWLock) TryLock(ctx context.Context) (bool, error) {
+	ok, err := l.tryLock(ctx)
+	if !ok {
+		l.cancelWait()
+	}
+	return ok, err
+}
+
+// 加写锁，直到获取到锁或者ctx被取消
+// 等待期间登记为等待中的写者，新的读者不能再加读锁
+func (l *RWLock) Lock(ctx context.Context) error {
+	err := l.lock.retry(ctx, l.tryLock)
+	if err != nil {
+		l.cancelWait()
+	}
+	return err
+}
+
+// 加写锁，最多等待wait,超时后返回false
+func (l *RWLock) TryLockFor(ctx context.Context, wait time.Duration) (bool, error) {
+	ok, err := l.lock.retryFor(ctx, wait, l.tryLock)
+	if !ok {
+		l.cancelWait()
+	}
+	return ok, err
+}
+
+// 释放写锁，返回是否持有写锁
+func (l *RWLock) Unlock(ctx context.Context) (bool, error) {
+	released, err := l.lock.Store.Eval(ctx, rwWriteUnlockCommand, []string{l.writerKey()}, l.lock.Value).Int64()
+	return released > 0, err
+}
+
+// 尝试加写锁一次，无法加锁时登记为等待中的写者
+func (l *RWLock) tryLock(ctx context.Context) (bool, error) {
+	return l.eval(ctx, rwWriteLockCommand)
+}
+
+func (l *RWLock) eval(ctx context.Context, script string) (bool, error) {
+	seconds := atomic.LoadUint32(&l.lock.Seconds)
+	ok, err := l.lock.Store.Eval(ctx, script, []string{l.writerKey(), l.readersKey(), l.waitingKey()}, []string{
+		l.lock.Value, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
+	}).Int64()
+	return ok == 1, err
+}
+
+// 放弃加写锁时取消等待中的写者登记，避免读者一直等到登记过期
+// 调用方的ctx可能已经被取消，使用单独的context
+func (l *RWLock) cancelWait() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l.lock.Store.Eval(ctx, rwWriteUnlockCommand, []string{l.waitingKey()}, l.lock.Value)
+}
+
+func (l *RWLock) writerKey() string {
+	return hashTagged(l.lock.Key) + "::write"
+}
+
+func (l *RWLock) readersKey() string {
+	return hashTagged(l.lock.Key) + "::readers"
+}
+
+func (l *RWLock) waitingKey() string {
+	return hashTagged(l.lock.Key) + "::writer_waiting"
+}
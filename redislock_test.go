@@ -0,0 +1,63 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 锁总是已经被其它持有者持有的Cmdable,记录加锁脚本的执行次数
+type lockedCmdable struct {
+	redis.Cmdable
+	evals int
+}
+
+func (c *lockedCmdable) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	c.evals++
+	return redis.NewCmdResult(nil, redis.Nil)
+}
+
+func TestTryLockForWithoutWait(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		wait time.Duration
+	}{
+		{"zero wait", context.Background(), 0},
+		{"negative wait", context.Background(), -time.Second},
+		{"canceled context", canceled, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &lockedCmdable{}
+			rl := NewRedisLock(store, "lock", "value", 10)
+			ok, err := rl.TryLockFor(tt.ctx, tt.wait)
+			if ok || err != nil {
+				t.Fatalf("TryLockFor() = %v, %v, want false, nil", ok, err)
+			}
+			if store.evals != 1 {
+				t.Fatalf("evals = %d, want 1", store.evals)
+			}
+		})
+	}
+}
+
+func TestTryLockForRetriesUntilWait(t *testing.T) {
+	store := &lockedCmdable{}
+	rl := NewRedisLock(store, "lock", "value", 10, WithLockBackoff(time.Millisecond, 5*time.Millisecond))
+	start := time.Now()
+	ok, err := rl.TryLockFor(context.Background(), 50*time.Millisecond)
+	if ok || err != nil {
+		t.Fatalf("TryLockFor() = %v, %v, want false, nil", ok, err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("TryLockFor() returned after %v, want at least the wait", elapsed)
+	}
+	if store.evals < 2 {
+		t.Fatalf("evals = %d, want retries within the wait", store.evals)
+	}
+}
@@ -0,0 +1,163 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	//仍然是持有者时刷新有效期，锁已经过期或者被其它持有者持有时返回0
+	renewCommand = `if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`
+)
+
+// 自动续期锁的有效期
+type lockWatchdog struct {
+	stop chan struct{}
+	//续期协程退出后关闭
+	done chan struct{}
+	//续期失败、失去锁时关闭
+	lost chan struct{}
+}
+
+// 启用watchdog,加锁成功后每隔interval刷新锁的有效期，直到RedisRelease或者失去锁
+// interval为0时使用锁有效期的1/3
+func WithWatchdog(interval time.Duration) LockOption {
+	return func(rl *RedisLock) {
+		rl.watchdogInterval = interval
+		if rl.watchdogInterval <= 0 {
+			rl.watchdogInterval = -1
+		}
+	}
+}
+
+// 返回在失去锁时关闭的channel
+// 只有启用watchdog并且已经加锁时才会关闭，否则返回nil
+func (rl *RedisLock) Lost() <-chan struct{} {
+	rl.watchdogMu.Lock()
+	defer rl.watchdogMu.Unlock()
+	if rl.watchdog == nil {
+		return nil
+	}
+	return rl.watchdog.lost
+}
+
+// 返回一个在失去锁时被取消的context,用于中止依赖锁的操作
+// 没有启用watchdog或者尚未加锁时只随ctx取消
+func (rl *RedisLock) OwnershipContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ownershipCtx, cancel := context.WithCancel(ctx)
+	lost := rl.Lost()
+	if lost == nil {
+		return ownershipCtx, cancel
+	}
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-ownershipCtx.Done():
+		}
+	}()
+	return ownershipCtx, cancel
+}
+
+// 续期的间隔
+func (rl *RedisLock) renewInterval() time.Duration {
+	if rl.watchdogInterval > 0 {
+		return rl.watchdogInterval
+	}
+	interval := time.Duration(atomic.LoadUint32(&rl.Seconds)) * time.Second / 3
+	if interval <= 0 {
+		interval = time.Second / 3
+	}
+	return interval
+}
+
+// 开始续期，已经在续期时不做处理
+func (rl *RedisLock) startWatchdog() {
+	if rl.watchdogInterval == 0 {
+		return
+	}
+	rl.watchdogMu.Lock()
+	defer rl.watchdogMu.Unlock()
+	if rl.watchdog != nil {
+		select {
+		case <-rl.watchdog.lost:
+		default:
+			return
+		}
+	}
+	w := &lockWatchdog{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		lost: make(chan struct{}),
+	}
+	rl.watchdog = w
+	go rl.renewLoop(w)
+}
+
+// 停止续期并等待续期协程退出，避免释放锁之后又被续期
+func (rl *RedisLock) stopWatchdog() {
+	rl.watchdogMu.Lock()
+	w := rl.watchdog
+	rl.watchdog = nil
+	rl.watchdogMu.Unlock()
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+}
+
+// 定时续期，锁已经不属于当前持有者，或者直到锁过期都没有续期成功时认为失去锁
+func (rl *RedisLock) renewLoop(w *lockWatchdog) {
+	defer close(w.done)
+	interval := rl.renewInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ok, err := rl.renew(ctx)
+		cancel()
+		ttl := time.Duration(atomic.LoadUint32(&rl.Seconds)) * time.Second
+		//续期完成时锁可能已经过期，期间可能被其它持有者持有过
+		if time.Since(renewedAt) >= ttl {
+			close(w.lost)
+			return
+		}
+		if ok {
+			renewedAt = start
+			continue
+		}
+		//返回0说明锁已经不属于当前持有者，出错时在锁过期前继续重试
+		if err == nil || err == redis.Nil {
+			close(w.lost)
+			return
+		}
+	}
+}
+
+// 只在仍然是持有者时刷新有效期，不会重新加锁，可重入锁也不增加持有次数
+func (rl *RedisLock) renew(ctx context.Context) (bool, error) {
+	command := renewCommand
+	if rl.reentrant {
+		command = reentrantRefreshCommand
+	}
+	seconds := atomic.LoadUint32(&rl.Seconds)
+	renewed, err := rl.Store.Eval(ctx, command, []string{rl.Key}, []string{
+		rl.Value, strconv.Itoa(int(seconds)*millisPerSecond + tolerance),
+	}).Int64()
+	return renewed == 1, err
+}
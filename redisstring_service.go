@@ -1,6 +1,11 @@
 package redis
 
-import "github.com/go-redis/redis/v8"
+import (
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
 
 type IRedisStringService interface {
 	//获取key值
@@ -9,6 +14,12 @@ type IRedisStringService interface {
 	StringMGet(opts []RedisValueOption, keys ...string) (map[string]IRedisValue, error)
 	//设置值
 	StringSet(key string, value interface{}, opts ...RedisValueOption) error
+	//一次设置多个值，指定了ttl时所有key使用相同的有效期
+	StringMSet(values map[string]interface{}, opts ...RedisValueOption) error
+	//读取-修改-写入,key在此期间被修改时自动重试
+	StringUpdate(key string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue
+	//获取key值,如果不存在则调用loader加载并写入redis
+	StringGetOrLoad(key string, loader LoaderFunc, opts ...RedisValueOption) IRedisValue
 
 	//自增id
 	KeyIncr(key string, opts ...RedisValueOption) (int64, error)
@@ -59,6 +70,12 @@ func (s *RedisStringService) StringMGet(opts []RedisValueOption, keys ...string)
 		normalizedKeys = append(normalizedKeys, currentNormalizedKey)
 		result[eachKey] = newNilRedisValue()
 	}
+	if len(keys) <= 0 {
+		return result, nil
+	}
+	if _, ok := s.options.client.(*redis.Client); !ok {
+		return s.pipelinedGet(options, keys, normalizedKeys, result)
+	}
 	b := s.options.client.MGet(options.ctx, normalizedKeys...)
 	if err := b.Err(); err != nil {
 		if err == redis.Nil {
@@ -82,6 +99,30 @@ func (s *RedisStringService) StringMGet(opts []RedisValueOption, keys ...string)
 	return result, nil
 }
 
+// Cluster/Ring模式下key可能分布在不同的slot,MGET会返回CROSSSLOT错误，改为按key执行GET,由pipeline按节点分组发送
+func (s *RedisStringService) pipelinedGet(options *RedisValueOptions, keys []string, normalizedKeys []string, result map[string]IRedisValue) (map[string]IRedisValue, error) {
+	cmds := make([]*redis.StringCmd, 0, len(normalizedKeys))
+	//每个命令的错误在下面单独处理
+	s.options.client.Pipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		for _, eachKey := range normalizedKeys {
+			cmds = append(cmds, pipe.Get(options.ctx, eachKey))
+		}
+		return nil
+	})
+	for i, eachKey := range keys {
+		b, err := cmds[i].Bytes()
+		//与MGET一致，不存在或者不是string类型的key返回nil
+		if err == redis.Nil || (err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[eachKey] = newRedisValue(b, s.options.Unmarshal)
+	}
+	return result, nil
+}
+
 func (s *RedisStringService) StringSet(key string, value interface{}, opts ...RedisValueOption) error {
 	options := s.options.createRedisValueOptions()
 	options.applyOption(opts...)
@@ -96,7 +137,144 @@ func (s *RedisStringService) StringSet(key string, value interface{}, opts ...Re
 	if options.ttl != nil {
 		ttl = *options.ttl
 	}
-	return s.options.client.Set(options.ctx, options.appendKeyPrefix(key), data, ttl).Err()
+	normalizedKey := options.appendKeyPrefix(key)
+	if len(options.tags) <= 0 {
+		return s.options.client.Set(options.ctx, normalizedKey, data, ttl).Err()
+	}
+	_, err = s.options.client.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(options.ctx, normalizedKey, data, ttl)
+		options.addTags(pipe, normalizedKey, ttl)
+		return nil
+	})
+	return err
+}
+
+// 一次设置多个值
+// 单机及Sentinel模式下在一个MULTI中执行MSET及每个key的PEXPIRE,
+// Cluster/Ring模式下key可能分布在不同节点，改为按key执行SET,由pipeline按节点分组发送
+// 未指定有效期时两种模式都会清除key原有的有效期
+func (s *RedisStringService) StringMSet(values map[string]interface{}, opts ...RedisValueOption) error {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	if len(values) <= 0 {
+		return nil
+	}
+	ttl := options.getTTL()
+	normalizedKeys := make([]string, 0, len(values))
+	pairs := make([]interface{}, 0, len(values)*2)
+	for eachKey, eachValue := range values {
+		data, err := options.marshal(eachValue)
+		if err != nil {
+			return err
+		}
+		normalizedKey := options.appendKeyPrefix(eachKey)
+		normalizedKeys = append(normalizedKeys, normalizedKey)
+		pairs = append(pairs, normalizedKey, data)
+	}
+
+	if _, ok := s.options.client.(*redis.Client); !ok {
+		//与MSET一致，未指定有效期时清除原有的有效期，而不是作为KEEPTTL保留
+		setTTL := ttl
+		if setTTL < 0 {
+			setTTL = 0
+		}
+		_, err := s.options.client.Pipelined(options.ctx, func(pipe redis.Pipeliner) error {
+			for i, eachKey := range normalizedKeys {
+				pipe.Set(options.ctx, eachKey, pairs[i*2+1], setTTL)
+				options.addTags(pipe, eachKey, ttl)
+			}
+			return nil
+		})
+		return err
+	}
+	_, err := s.options.client.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+		pipe.MSet(options.ctx, pairs...)
+		for _, eachKey := range normalizedKeys {
+			if ttl > 0 {
+				pipe.PExpire(options.ctx, eachKey, ttl)
+			}
+			options.addTags(pipe, eachKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// 获取key值,如果不存在则调用loader加载，并按配置的ttl及marshal写入redis
+// 同一进程内对同一key的并发加载只会调用一次loader
+// 可以通过WithRebuildLock、WithStaleTTL、WithEarlyRefresh启用缓存击穿保护
+// loader返回ErrKeyNotExist且指定了WithNegativeTTL时，会将不存在的结果缓存起来
+func (s *RedisStringService) StringGetOrLoad(key string, loader LoaderFunc, opts ...RedisValueOption) IRedisValue {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	normalizedKey := options.appendKeyPrefix(key)
+	c := &cacheAside{
+		client:    s.options.client,
+		options:   options,
+		key:       normalizedKey,
+		flightKey: stringFlightKey(normalizedKey),
+		auxKey:    normalizedKey,
+		get: func() IRedisValue {
+			return s.StringGet(key, opts...)
+		},
+		set: func(pipe redis.Pipeliner, data []byte, ttl time.Duration) {
+			pipe.Set(options.ctx, normalizedKey, data, ttl)
+		},
+		ttl: func() *time.Duration {
+			return s.KeyTimeToLive(key, opts...)
+		},
+	}
+	return c.getOrLoad(s.options.loadGroup, loader)
+}
+
+// 使用WATCH/MULTI/EXEC对key执行读取-修改-写入
+// fn的返回值按配置的marshal及ttl写入，返回nil时删除key
+// 事务因为key被修改而失败时按WithMaxRetries、WithRetryBackoff重试
+func (s *RedisStringService) StringUpdate(key string, fn UpdateFunc, opts ...RedisValueOption) IRedisValue {
+	options := s.options.createRedisValueOptions()
+	options.applyOption(opts...)
+
+	normalizedKey := options.appendKeyPrefix(key)
+	ttl := options.getTTL()
+	var result IRedisValue
+	err := s.options.watch(options, func(tx *redis.Tx) error {
+		b, err := tx.Get(options.ctx, normalizedKey).Bytes()
+		current := toRedisValue(b, err, options.unmarshal)
+		if err := current.Err(); err != nil {
+			return err
+		}
+		value, err := fn(current)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			result = newNilRedisValue()
+			_, err = tx.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(options.ctx, normalizedKey)
+				return nil
+			})
+			return err
+		}
+		data, err := options.marshal(value)
+		if err != nil {
+			return err
+		}
+		result = newRedisValue(data, options.unmarshal)
+		_, err = tx.TxPipelined(options.ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(options.ctx, normalizedKey, data, ttl)
+			return nil
+		})
+		return err
+	}, normalizedKey)
+	if err != nil {
+		return newErrRedisValue(err)
+	}
+	if err := s.addTags(options, normalizedKey, ttl); err != nil {
+		return newErrRedisValue(err)
+	}
+	return result
 }
 
 func (s *RedisStringService) KeyIncr(key string, opts ...RedisValueOption) (int64, error) {
@@ -9,6 +9,8 @@ import (
 type IRedisValue interface {
 	//获取值是否存在
 	Exist() bool
+	//值是否被缓存为不存在(负缓存)
+	IsAbsent() bool
 	Bytes() []byte
 	Err() error
 
@@ -35,6 +37,30 @@ type RedisValueOptions struct {
 	//在get时如果为空，是否自动load
 	loadIfEmpty bool
 
+	//SCAN时每次迭代的COUNT
+	scanCount int64
+	//批量操作时每批的key数量
+	batchSize int
+	//SCAN时过滤的key类型
+	keyType string
+
+	//重建缓存时分布式锁的有效期，为0表示不使用分布式锁
+	rebuildLockTTL time.Duration
+	//过期后旧值副本的保留时间，为0表示不保留
+	staleTTL time.Duration
+	//XFetch提前重建的beta参数，为0表示不提前重建
+	earlyRefreshBeta float64
+	//loader返回ErrKeyNotExist时墓碑值的有效期，为0表示不缓存
+	negativeTTL time.Duration
+	//写入时为key打上的tag
+	tags []string
+
+	//乐观事务的最大重试次数
+	maxRetries int
+	//重试的最小、最大等待时间
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
 	unmarshal UnmarshalFunc
 	marshal   MarshalFunc
 }
@@ -47,10 +73,23 @@ func (o *RedisValueOptions) appendKeyPrefix(key string) string {
 	return ensureStartWith(key, o.keyPrefix)
 }
 
+// 获取有效期，如果没有指定则不过期
+func (o *RedisValueOptions) getTTL() time.Duration {
+	if o.ttl != nil {
+		return *o.ttl
+	}
+	return Redis_NoExpiration_TTL
+}
+
 func newRedisValueOptions() *RedisValueOptions {
 	return &RedisValueOptions{
 		withoutPrefixKey: false,
 		loadIfEmpty:      true,
+		scanCount:        defaultScanCount,
+		batchSize:        defaultScanBatchSize,
+		maxRetries:       defaultTxMaxRetries,
+		minBackoff:       defaultTxMinBackoff,
+		maxBackoff:       defaultTxMaxBackoff,
 	}
 }
 
@@ -7,6 +7,9 @@ type RedisValueMap map[string]IRedisValue
 func RedisValueMapToSlice[V any](vMap RedisValueMap, filterFn func(*V) bool) ([]*V, error) {
 	valueList := make([]*V, 0)
 	for _, eachValue := range vMap {
+		if eachValue.IsAbsent() {
+			continue
+		}
 		currentValue := new(V)
 		err := _unmarshal(eachValue.Bytes(), currentValue)
 		if err != nil {
@@ -23,6 +26,9 @@ func RedisValueMapToSlice[V any](vMap RedisValueMap, filterFn func(*V) bool) ([]
 func RedisValueMapToMap[V any](vMap RedisValueMap, filterFn func(*V) bool) (map[string]*V, error) {
 	valueMap := make(map[string]*V)
 	for eachKey, eachValue := range vMap {
+		if eachValue.IsAbsent() {
+			continue
+		}
 		currentValue := new(V)
 		err := _unmarshal(eachValue.Bytes(), currentValue)
 		if err != nil {
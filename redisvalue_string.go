@@ -8,6 +8,11 @@ import (
 type redisStringValue struct {
 	data []byte
 	err  error
+	//是否为负缓存的墓碑值
+	absent bool
+	//刚写入redis时记录的有效期，ttlKnown为false表示未知，ttl为0表示没有过期时间
+	ttl      time.Duration
+	ttlKnown bool
 
 	unmarshal UnmarshalFunc
 }
@@ -15,6 +20,9 @@ type redisStringValue struct {
 var _ IRedisValue = (*redisStringValue)(nil)
 
 func newRedisValue(data []byte, unmarshal UnmarshalFunc) *redisStringValue {
+	if isTombstone(data) {
+		return newAbsentRedisValue()
+	}
 	return &redisStringValue{
 		data:      data,
 		unmarshal: unmarshal,
@@ -29,6 +37,29 @@ func newNilRedisValue() *redisStringValue {
 	}
 }
 
+// 构建被缓存为不存在的IRedisValue
+func newAbsentRedisValue() *redisStringValue {
+	return &redisStringValue{
+		data:   nil,
+		err:    nil,
+		absent: true,
+	}
+}
+
+// 记录值在redis中的有效期，ttl小于0(KEEPTTL)时剩余有效期未知，不做记录
+func (v *redisStringValue) withTTL(ttl time.Duration) *redisStringValue {
+	if ttl >= 0 {
+		v.ttl = ttl
+		v.ttlKnown = true
+	}
+	return v
+}
+
+// 返回写入时记录的有效期
+func (v *redisStringValue) knownTTL() (time.Duration, bool) {
+	return v.ttl, v.ttlKnown
+}
+
 func newErrRedisValue(err error) *redisStringValue {
 	return &redisStringValue{
 		data: nil,
@@ -40,6 +71,10 @@ func (v *redisStringValue) Exist() bool {
 	return v.data != nil
 }
 
+func (v *redisStringValue) IsAbsent() bool {
+	return v.absent
+}
+
 func (v *redisStringValue) Bytes() []byte {
 	return v.data
 }
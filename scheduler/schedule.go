@@ -0,0 +1,197 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 计算触发时间
+type Schedule interface {
+	//返回t之后(不包括t)的下一次触发时间
+	Next(t time.Time) time.Time
+}
+
+// 固定间隔的触发时间，以Unix纪元对齐，所有实例计算出的触发时间相同
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// 每隔interval触发一次，interval最小为1秒
+func Every(interval time.Duration) Schedule {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return &intervalSchedule{interval: interval}
+}
+
+func (s *intervalSchedule) Next(t time.Time) time.Time {
+	n := int64(s.interval)
+	return time.Unix(0, (t.UnixNano()/n+1)*n).In(t.Location())
+}
+
+// cron表达式的触发时间
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	//日期与星期是否不以*开头,两者都不以*开头时满足其一即可
+	domRestricted, dowRestricted bool
+	location                     *time.Location
+}
+
+// 各字段的取值范围
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, //分
+	{0, 23}, //时
+	{1, 31}, //日
+	{1, 12}, //月
+	{0, 7},  //星期,0和7都表示星期日
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// 解析标准的5段cron表达式(分 时 日 月 星期),按loc计算时间,loc为nil时使用time.Local
+// 支持*、逗号分隔的列表、a-b范围以及/n步长，同时支持@hourly、@daily等描述符和@every <duration>
+func ParseCron(expr string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: invalid cron expression %q: %w", expr, err)
+		}
+		return Every(interval), nil
+	}
+	if descriptor, ok := cronDescriptors[expr]; ok {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("scheduler: invalid cron expression %q: expected %d fields", expr, len(cronFields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, eachField := range fields {
+		b, err := parseCronField(eachField, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("scheduler: invalid cron expression %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+	//星期日可以写作0或者7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronSchedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dom:           bits[2],
+		month:         bits[3],
+		dow:           bits[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+		location:      loc,
+	}, nil
+}
+
+// 将一个字段解析为位图，第i位表示取值i
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var bits uint64
+	for _, eachPart := range strings.Split(field, ",") {
+		rangePart, step, hasStep := eachPart, 1, false
+		if i := strings.Index(eachPart, "/"); i >= 0 {
+			hasStep = true
+			var err error
+			rangePart = eachPart[:i]
+			step, err = strconv.Atoi(eachPart[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", eachPart)
+			}
+		}
+		start, end := bounds.min, bounds.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			values := strings.SplitN(rangePart, "-", 2)
+			var err1, err2 error
+			start, err1 = strconv.Atoi(values[0])
+			end, err2 = strconv.Atoi(values[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			start = value
+			//a/n表示从a开始到最大值
+			if !hasStep {
+				end = value
+			}
+		}
+		if start < bounds.min || end > bounds.max || start > end {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", eachPart, bounds.min, bounds.max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	if bits == 0 {
+		return 0, errors.New("empty field")
+	}
+	return bits, nil
+}
+
+// 最多向后查找的年数，避免2月30日之类永远不会触发的表达式死循环
+const cronSearchYears = 5
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	origLocation := t.Location()
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.In(origLocation)
+	}
+	return time.Time{}
+}
+
+// 日期与星期都指定时满足其一即可，否则两者都需要满足
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
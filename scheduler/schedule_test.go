@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	minute := cronFields[0]
+	tests := []struct {
+		field   string
+		bounds  cronField
+		want    []int
+		wantErr bool
+	}{
+		{"*", cronField{0, 3}, []int{0, 1, 2, 3}, false},
+		{"5", minute, []int{5}, false},
+		{"1,3,5", minute, []int{1, 3, 5}, false},
+		{"10-12", minute, []int{10, 11, 12}, false},
+		{"*/20", minute, []int{0, 20, 40}, false},
+		{"10-30/10", minute, []int{10, 20, 30}, false},
+		{"55/2", minute, []int{55, 57, 59}, false},
+		{"57/1", minute, []int{57, 58, 59}, false},
+		{"60", minute, nil, true},
+		{"5-1", minute, nil, true},
+		{"*/0", minute, nil, true},
+		{"a", minute, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			bits, err := parseCronField(tt.field, tt.bounds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var want uint64
+			for _, v := range tt.want {
+				want |= 1 << uint(v)
+			}
+			if bits != want {
+				t.Fatalf("bits = %b, want %b", bits, want)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	//2026-10-18为星期日
+	base := time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want []time.Time
+	}{
+		{"*/15 * * * *", []time.Time{
+			time.Date(2026, 10, 18, 10, 15, 0, 0, time.UTC),
+			time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC),
+		}},
+		{"0 9 * * 1-5", []time.Time{
+			time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+		}},
+		{"@hourly", []time.Time{
+			time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		}},
+		{"0 0 29 2 *", []time.Time{
+			time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC),
+		}},
+		//日期与星期都指定时满足其一即可:13日或者星期五
+		{"0 12 13 * 5", []time.Time{
+			time.Date(2026, 10, 23, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 10, 30, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 11, 6, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 11, 13, 12, 0, 0, 0, time.UTC),
+		}},
+		//星期为*时只按日期
+		{"0 12 13 * *", []time.Time{
+			time.Date(2026, 11, 13, 12, 0, 0, 0, time.UTC),
+		}},
+		//日期以*开头时需要同时满足日期与星期:奇数日并且是星期日
+		{"0 12 */2 * 0", []time.Time{
+			time.Date(2026, 10, 25, 12, 0, 0, 0, time.UTC),
+			time.Date(2026, 11, 1, 12, 0, 0, 0, time.UTC),
+		}},
+		//星期日写作7
+		{"0 0 * * 7", []time.Time{
+			time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC),
+		}},
+		{"@every 90s", []time.Time{
+			time.Date(2026, 10, 18, 10, 9, 0, 0, time.UTC),
+			time.Date(2026, 10, 18, 10, 10, 30, 0, time.UTC),
+		}},
+		{"0 0 30 2 *", []time.Time{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := base
+			for _, want := range tt.want {
+				next = schedule.Next(next)
+				if !next.Equal(want) {
+					t.Fatalf("next = %v, want %v", next, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "61 * * * *", "@every abc", "@unknown"} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Errorf("ParseCron(%q) expected error", expr)
+		}
+	}
+}
+
+func TestLatestTick(t *testing.T) {
+	now := time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC)
+	weekdays, err := ParseCron("0 9 * * 1-5", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		schedule Schedule
+		last     time.Time
+		want     time.Time
+	}{
+		{"every second after long downtime", Every(time.Second), now.Add(-48 * time.Hour), now.Truncate(time.Second)},
+		{"every minute just missed", Every(time.Minute), now.Add(-90 * time.Second), time.Date(2026, 10, 18, 10, 7, 0, 0, time.UTC)},
+		{"cron missed a month", weekdays, now.Add(-30 * 24 * time.Hour), time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)},
+		{"cron nothing due since last", weekdays, now.Add(-time.Hour), time.Time{}},
+		{"interval nothing due since last", Every(time.Hour), now.Add(-time.Minute), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestTick(tt.schedule, tt.last, now); !got.Equal(tt.want) {
+				t.Fatalf("latestTick = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
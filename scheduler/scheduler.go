@@ -0,0 +1,391 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	redisx "github.com/shanluzhineng/redisx"
+	"github.com/shanluzhineng/redisx/queue"
+)
+
+// 错过的触发时间的处理方式
+type CatchUpPolicy int
+
+const (
+	//只补触发最近一次错过的触发时间
+	CatchUpOnce CatchUpPolicy = iota
+	//跳过错过的触发时间，最近一次触发时间距今不超过WithMisfireThreshold时仍然触发
+	CatchUpSkip
+	//依次补触发所有错过的触发时间，每次检查最多补触发WithMaxCatchUp次
+	CatchUpAll
+)
+
+const (
+	//key的默认前缀
+	defaultKeyPrefix = "mq::scheduler::"
+	//每次检查最多补触发的次数
+	defaultMaxCatchUp = 100
+
+	//记录的触发时间比当前值更晚时才更新
+	advanceCommand = `local current = tonumber(redis.call("GET", KEYS[1]))
+if current and current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return 1`
+)
+
+// 根据触发时间生成消息内容
+type PayloadFunc func(ctx context.Context, tick time.Time) (interface{}, error)
+
+// 定时将消息放入队列，多个实例同时运行时每个触发时间只会有一个实例入队
+type Scheduler struct {
+	client redis.UniversalClient
+
+	//当前实例的id,作为每个触发时间锁的值
+	instanceID string
+	keyPrefix  string
+	//检查是否到达触发时间的间隔
+	checkInterval time.Duration
+	//每个触发时间锁的有效期(秒)
+	tickLockSeconds uint32
+	//CatchUpSkip时仍然触发的最大延迟
+	misfireThreshold time.Duration
+	location         *time.Location
+	errCallback      func(err error)
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type SchedulerOption func(s *Scheduler)
+
+// 注册的一个定时任务
+type entry struct {
+	name     string
+	schedule Schedule
+	queue    *queue.Queue
+	payload  interface{}
+
+	enqueueOpts []queue.EnqueueOption
+	catchUp     CatchUpPolicy
+	maxCatchUp  int
+}
+
+type EntryOption func(e *entry)
+
+// 指定key的前缀，默认为mq::scheduler::
+func WithKeyPrefix(keyPrefix string) SchedulerOption {
+	return func(s *Scheduler) {
+		s.keyPrefix = keyPrefix
+	}
+}
+
+// 指定检查是否到达触发时间的间隔，即任务最多晚于触发时间多久入队，默认为1秒
+func WithCheckInterval(interval time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		if interval > 0 {
+			s.checkInterval = interval
+		}
+	}
+}
+
+// 指定每个触发时间锁的有效期，默认为1小时
+// 有效期内其它实例不会再次触发同一个触发时间
+func WithTickLockTTL(ttl time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		if ttl >= time.Second {
+			s.tickLockSeconds = uint32(ttl / time.Second)
+		}
+	}
+}
+
+// 指定CatchUpSkip时仍然触发的最大延迟，默认为1分钟
+func WithMisfireThreshold(threshold time.Duration) SchedulerOption {
+	return func(s *Scheduler) {
+		s.misfireThreshold = threshold
+	}
+}
+
+// 指定RegisterCron计算触发时间使用的时区，默认为time.Local
+func WithLocation(loc *time.Location) SchedulerOption {
+	return func(s *Scheduler) {
+		if loc != nil {
+			s.location = loc
+		}
+	}
+}
+
+// 指定Run过程中发生错误时的回调
+func WithErrorCallback(errCallback func(err error)) SchedulerOption {
+	return func(s *Scheduler) {
+		s.errCallback = errCallback
+	}
+}
+
+// 指定入队时的参数，例如queue.WithPriority
+func WithEnqueueOptions(opts ...queue.EnqueueOption) EntryOption {
+	return func(e *entry) {
+		e.enqueueOpts = opts
+	}
+}
+
+// 指定错过的触发时间的处理方式，默认为CatchUpOnce
+func WithCatchUp(policy CatchUpPolicy) EntryOption {
+	return func(e *entry) {
+		e.catchUp = policy
+	}
+}
+
+// 指定CatchUpAll时每次检查最多补触发的次数，默认为100
+func WithMaxCatchUp(maxCatchUp int) EntryOption {
+	return func(e *entry) {
+		if maxCatchUp > 0 {
+			e.maxCatchUp = maxCatchUp
+		}
+	}
+}
+
+func NewScheduler(client redis.UniversalClient, opts ...SchedulerOption) *Scheduler {
+	s := &Scheduler{
+		client:           client,
+		instanceID:       newInstanceID(),
+		keyPrefix:        defaultKeyPrefix,
+		checkInterval:    time.Second,
+		tickLockSeconds:  uint32(time.Hour / time.Second),
+		misfireThreshold: time.Minute,
+		location:         time.Local,
+		entries:          make(map[string]*entry),
+	}
+	for _, eachOpt := range opts {
+		eachOpt(s)
+	}
+	return s
+}
+
+// 注册定时任务，每次触发时将payload放入q
+// payload为PayloadFunc或者func(context.Context, time.Time) (interface{}, error)时每次触发调用它生成消息内容
+// 所有实例应使用相同的name注册同一个任务，name用于在实例之间协调触发
+func (s *Scheduler) Register(name string, schedule Schedule, q *queue.Queue, payload interface{}, opts ...EntryOption) error {
+	if len(name) <= 0 {
+		return errors.New("必须指定name")
+	}
+	if schedule == nil || q == nil {
+		return errors.New("必须指定schedule和queue")
+	}
+	e := &entry{
+		name:       name,
+		schedule:   schedule,
+		queue:      q,
+		payload:    payload,
+		catchUp:    CatchUpOnce,
+		maxCatchUp: defaultMaxCatchUp,
+	}
+	for _, eachOpt := range opts {
+		eachOpt(e)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[name]; ok {
+		return fmt.Errorf("scheduler: entry %s already registered", name)
+	}
+	s.entries[name] = e
+	return nil
+}
+
+// 按cron表达式注册定时任务，表达式格式见ParseCron
+func (s *Scheduler) RegisterCron(name string, expr string, q *queue.Queue, payload interface{}, opts ...EntryOption) error {
+	schedule, err := ParseCron(expr, s.location)
+	if err != nil {
+		return err
+	}
+	return s.Register(name, schedule, q, payload, opts...)
+}
+
+// 按固定间隔注册定时任务
+func (s *Scheduler) RegisterInterval(name string, interval time.Duration, q *queue.Queue, payload interface{}, opts ...EntryOption) error {
+	return s.Register(name, Every(interval), q, payload, opts...)
+}
+
+// 取消注册定时任务
+func (s *Scheduler) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, name)
+}
+
+// 定时检查并触发到期的任务，本函数会阻塞直到ctx被取消
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		s.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 检查一次所有任务，触发到期的任务
+func (s *Scheduler) Tick(ctx context.Context) {
+	s.mu.Lock()
+	entries := make([]*entry, 0, len(s.entries))
+	for _, eachEntry := range s.entries {
+		entries = append(entries, eachEntry)
+	}
+	s.mu.Unlock()
+
+	for _, eachEntry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.check(ctx, eachEntry, time.Now()); err != nil {
+			s.reportError(err)
+		}
+	}
+}
+
+// 按补触发策略触发entry在now之前到期的触发时间
+func (s *Scheduler) check(ctx context.Context, e *entry, now time.Time) error {
+	last, err := s.lastFired(ctx, e, now)
+	if err != nil {
+		return err
+	}
+	if e.catchUp == CatchUpAll {
+		for i := 0; i < e.maxCatchUp; i++ {
+			tick := e.schedule.Next(last)
+			if tick.IsZero() || tick.After(now) {
+				return nil
+			}
+			if err := s.fire(ctx, e, tick); err != nil {
+				return err
+			}
+			last = tick
+		}
+		return nil
+	}
+	tick := latestTick(e.schedule, last, now)
+	if tick.IsZero() {
+		return nil
+	}
+	if e.catchUp == CatchUpSkip && now.Sub(tick) > s.misfireThreshold {
+		return s.advance(ctx, e, tick)
+	}
+	return s.fire(ctx, e, tick)
+}
+
+// 通过触发时间锁保证只有一个实例将消息入队，入队失败时释放锁以便重试
+func (s *Scheduler) fire(ctx context.Context, e *entry, tick time.Time) error {
+	lock := redisx.NewRedisLock(s.client, s.tickKey(e, tick), s.instanceID, s.tickLockSeconds)
+	ok, err := lock.TryLock(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		//已经被其它实例触发
+		return s.advance(ctx, e, tick)
+	}
+	payload, err := e.resolvePayload(ctx, tick)
+	if err == nil {
+		_, err = e.queue.Enqueue(ctx, payload, e.enqueueOpts...)
+	}
+	if err != nil {
+		lock.RedisRelease(ctx)
+		return fmt.Errorf("scheduler: fire %s at %s failed: %w", e.name, tick.Format(time.RFC3339), err)
+	}
+	return s.advance(ctx, e, tick)
+}
+
+// 生成本次触发的消息内容，payload为PayloadFunc或者相同签名的函数时调用它生成
+func (e *entry) resolvePayload(ctx context.Context, tick time.Time) (interface{}, error) {
+	switch fn := e.payload.(type) {
+	case PayloadFunc:
+		return fn(ctx, tick)
+	case func(ctx context.Context, tick time.Time) (interface{}, error):
+		return fn(ctx, tick)
+	default:
+		return e.payload, nil
+	}
+}
+
+// 获取entry最后一次触发的时间，第一次运行时从now开始计算，不补触发之前的触发时间
+func (s *Scheduler) lastFired(ctx context.Context, e *entry, now time.Time) (time.Time, error) {
+	key := s.lastKey(e)
+	millis, err := s.client.Get(ctx, key).Int64()
+	if err == nil {
+		return time.UnixMilli(millis), nil
+	}
+	if err != redis.Nil {
+		return time.Time{}, err
+	}
+	if err := s.client.SetNX(ctx, key, now.UnixMilli(), 0).Err(); err != nil {
+		return time.Time{}, err
+	}
+	return now, nil
+}
+
+// 记录entry最后一次触发的时间
+func (s *Scheduler) advance(ctx context.Context, e *entry, tick time.Time) error {
+	return s.client.Eval(ctx, advanceCommand, []string{s.lastKey(e)}, tick.UnixMilli()).Err()
+}
+
+func (s *Scheduler) lastKey(e *entry) string {
+	return s.keyPrefix + e.name + "::last"
+}
+
+func (s *Scheduler) tickKey(e *entry, tick time.Time) string {
+	return s.keyPrefix + e.name + "::tick::" + strconv.FormatInt(tick.UnixMilli(), 10)
+}
+
+func (s *Scheduler) reportError(err error) {
+	if s.errCallback == nil {
+		return
+	}
+	defer func() {
+		if funcErr := recover(); funcErr != nil {
+			fmt.Println("invoke scheduler error callback occur panic", funcErr)
+		}
+	}()
+	s.errCallback(err)
+}
+
+// 查找last之后、不晚于now的最后一个触发时间，没有时返回零值
+// 从now向前按倍增的窗口查找，避免长时间停机后逐个遍历错过的触发时间
+func latestTick(schedule Schedule, last time.Time, now time.Time) time.Time {
+	for window := time.Minute; ; window *= 2 {
+		from := now.Add(-window)
+		if !from.After(last) {
+			from = last
+		}
+		tick := schedule.Next(from)
+		if !tick.IsZero() && !tick.After(now) {
+			for {
+				next := schedule.Next(tick)
+				if next.IsZero() || next.After(now) {
+					return tick
+				}
+				tick = next
+			}
+		}
+		if from.Equal(last) {
+			return time.Time{}
+		}
+	}
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
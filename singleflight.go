@@ -0,0 +1,45 @@
+package redis
+
+import "sync"
+
+// 正在执行中的一次调用
+type flightCall struct {
+	wg  sync.WaitGroup
+	val IRedisValue
+}
+
+// 将同一进程内对同一个key的并发调用合并为一次调用
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: make(map[string]*flightCall),
+	}
+}
+
+// 执行fn,如果同一个key已经有调用在执行中，则等待其完成并共享其结果
+func (g *flightGroup) Do(key string, fn func() IRedisValue) IRedisValue {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val = newErrRedisValue(errLoaderPanic)
+	c.val = fn()
+	return c.val
+}
@@ -1,6 +1,13 @@
 package redis
 
-import "strings"
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
 
 // 确保字符串以指定的字符串开始，如果不以原有的字符串开始，则自动加上
 func ensureStartWith(s string, prefix string) string {
@@ -14,3 +21,39 @@ func ensureStartWith(s string, prefix string) string {
 	}
 	return prefix + s
 }
+
+// 在每个master节点上执行fn
+// Cluster模式下遍历所有master，Ring模式下遍历所有shard，其它模式直接在client上执行
+func forEachMaster(ctx context.Context, client redis.UniversalClient, fn func(context.Context, redis.UniversalClient) error) error {
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return fn(ctx, master)
+		})
+	case *redis.Ring:
+		return c.ForEachShard(ctx, func(ctx context.Context, shard *redis.Client) error {
+			return fn(ctx, shard)
+		})
+	}
+	return fn(ctx, client)
+}
+
+// 生成n字节长度的随机串，以16进制表示
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// 返回与key位于同一个cluster slot的前缀，用于派生需要在同一个脚本中访问的key
+// key已经包含hash tag时原样返回，否则将整个key作为hash tag
+func hashTagged(key string) string {
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key
+		}
+	}
+	return "{" + key + "}"
+}